@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"route-manager/routemanager"
+	"slices"
+	"time"
+)
+
+// commands run without a window, e.g. from a script, CI or a systemd unit:
+//
+//	route-manager [-store DIR] plan [-prune] FILE    shows what apply would change
+//	route-manager [-store DIR] apply [-prune] FILE   converges the system to FILE
+//
+// FILE is a desired-state file in YAML or TOML, see routemanager.LoadDesiredState.
+// What apply manages is recorded in the store.
+var commands = []string{"plan", "apply"}
+
+// isCommand reports whether the program was started with a command instead of for the GUI.
+func isCommand(args []string) bool {
+	return len(args) > 0 && slices.Contains(commands, args[0])
+}
+
+// runCommand runs a command and returns the exit status.
+func runCommand(args []string) int {
+	name := args[0]
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	prune := flags.Bool("prune", false, "also remove managed routes and rules that are no longer in the file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: route-manager %s [-prune] FILE\n", name)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+
+	state, err := routemanager.LoadDesiredState(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	plan, err := routemanager.PlanState(state, *prune, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return 1
+	}
+	if plan.Empty() {
+		fmt.Printf("The system matches %s.\n", path)
+	} else {
+		fmt.Println(plan)
+	}
+	if name == "plan" {
+		return 0
+	}
+
+	// Applied even without changes, so routes that were already there become managed.
+	if err := routemanager.ApplyPlan(plan); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return 1
+	}
+	if !plan.Empty() {
+		fmt.Println("Applied.")
+	}
+	return 0
+}
@@ -2,23 +2,37 @@
 package gui
 
 import (
+	"log"
 	"route-manager/gui/components"
 	"route-manager/routemanager"
 	"route-manager/validators"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
 )
 
 // AppHeader struct is unchanged.
 type AppHeader struct {
 	View fyne.CanvasObject
 
-	OnAdd func(route routemanager.StaticRoute, save bool)
+	OnAdd func(route routemanager.StaticRoute, save bool, lifetime time.Duration) // A lifetime of 0 keeps the route
 
 	destInput    *components.InputField
 	gatewayInput *components.InputField
+	metricInput  *components.InputField
+	srcInput     *components.InputField
+	mtuInput     *components.InputField
+	advMSSInput  *components.InputField
+	cwndInput    *components.InputField
+	rwndInput    *components.InputField
+	descInput    *widget.Entry
+	tagsInput    *widget.Entry
 	addButton    *components.CustomButton
+
+	interfaceChoice *components.ChoiceList
 }
 
 // NewAppHeader creates a new header component.
@@ -26,31 +40,98 @@ func NewAppHeader() *AppHeader {
 	header := &AppHeader{}
 
 	header.destInput = components.NewInputField("Destination (e.g. 10.226.98.107/32)", validators.ValidateCIDR)
-	header.gatewayInput = components.NewInputField("Gateway (e.g. 10.226.35.1)", validators.ValidateIP)
+	header.gatewayInput = components.NewInputField("Gateway (optional, e.g. 10.226.35.1)", validators.ValidateOptionalIP)
+
+	header.metricInput = components.NewInputField("Metric", validators.ValidateOptionalUint)
+
+	interfaceNames := routemanager.GetInterfaceNames()
+	interfaceChoice := components.NewChoiceList(interfaceLabels(interfaceNames))
+	header.interfaceChoice = interfaceChoice
+
+	// The kernel rejects a source address that isn't assigned to the host,
+	// so only accept addresses of the interface the route goes out of.
+	header.srcInput = components.NewInputField("Source address (optional)", func(s string) bool {
+		s = strings.TrimSpace(s)
+		return s == "" || routemanager.InterfaceHasAddress(interfaceFromLabel(interfaceChoice.Selected()), s)
+	})
+	header.mtuInput = components.NewInputField("MTU", validators.ValidateOptionalUint)
+	header.advMSSInput = components.NewInputField("Advertised MSS", validators.ValidateOptionalUint)
+	header.cwndInput = components.NewInputField("Initial cwnd", validators.ValidateOptionalUint)
+	header.rwndInput = components.NewInputField("Initial rwnd", validators.ValidateOptionalUint)
+	var tableNames []string
+	for _, table := range routemanager.RoutingTables() {
+		if !routemanager.IsHiddenTable(table.ID) {
+			tableNames = append(tableNames, table.Name)
+		}
+	}
+	tableChoice := components.NewChoiceList(tableNames) // Main comes first
+	// An empty choice keeps the system default congestion control.
+	congestionChoice := components.NewChoiceList(append([]string{""}, routemanager.GetCongestionControls()...))
+	congestionChoice.View.PlaceHolder = "Congestion control"
 
 	header.destInput.SetMinWidth(160.0)
 	header.gatewayInput.SetMinWidth(160.0)
+	header.metricInput.SetMinWidth(80.0)
+	header.srcInput.SetMinWidth(160.0)
+	for _, input := range []*components.InputField{header.mtuInput, header.advMSSInput, header.cwndInput, header.rwndInput} {
+		input.SetMinWidth(110.0)
+	}
+
+	// Metadata is optional, so these are plain entries without validation.
+	header.descInput = widget.NewEntry()
+	header.descInput.SetPlaceHolder("Description (optional, e.g. Jira on the office LAN)")
+	header.tagsInput = widget.NewEntry()
+	header.tagsInput.SetPlaceHolder("Tags (comma separated)")
 
-	interfaceNames := routemanager.GetInterfaceNames()
-	interfaceChoice := components.NewChoiceList(interfaceNames)
 	saveCheckbox := components.NewCustomCheckbox("Save")
+	// Routes for a debugging session remove themselves, even if the app was closed meanwhile.
+	var lifetimeLabels []string
+	for _, l := range routeLifetimes {
+		lifetimeLabels = append(lifetimeLabels, l.label)
+	}
+	lifetimeChoice := components.NewChoiceList(lifetimeLabels)
+	onLinkCheckbox := components.NewCustomCheckbox("On-link")
+	typeChoice := components.NewChoiceList(routeTypeLabels())
 
 	header.addButton = components.NewCustomButton("Add Route", func() {
 		if header.OnAdd != nil {
 			route := routemanager.StaticRoute{
+				Type:        routeTypeFromLabel(typeChoice.Selected()),
 				Destination: header.destInput.Text(),
-				Gateway:     header.gatewayInput.Text(),
-				Interface:   interfaceChoice.Selected(),
+				Metric:      parseOptionalInt(header.metricInput.Text()),
+				Table:       tableID(tableChoice.Selected()),
+				Namespace:   routemanager.CurrentNamespace(),
+				Description: strings.TrimSpace(header.descInput.Text),
+				Tags:        parseTags(header.tagsInput.Text),
+				PathAttributes: routemanager.PathAttributes{
+					MTU:        parseOptionalInt(header.mtuInput.Text()),
+					AdvMSS:     parseOptionalInt(header.advMSSInput.Text()),
+					InitCwnd:   parseOptionalInt(header.cwndInput.Text()),
+					InitRwnd:   parseOptionalInt(header.rwndInput.Text()),
+					Congestion: congestionChoice.Selected(),
+				},
 			}
-			header.OnAdd(route, saveCheckbox.IsChecked())
+			// Special routes drop the traffic themselves, so they go nowhere.
+			if !routemanager.IsSpecialType(route.Type) {
+				route.Gateway = strings.TrimSpace(header.gatewayInput.Text())
+				route.OnLink = onLinkCheckbox.IsChecked()
+				route.Interface = interfaceFromLabel(interfaceChoice.Selected())
+				route.Src = strings.TrimSpace(header.srcInput.Text())
+			}
+			header.OnAdd(route, saveCheckbox.IsChecked(), routeLifetime(lifetimeChoice.Selected()))
 		}
 	})
 	header.addButton.SetMinWidth(120.0)
 	header.addButton.Disable()
 
-	var isDestValid, isGatewayValid bool
+	var isDestValid, isSpecialType bool
+	// The gateway and metric are optional, so an empty field is fine
+	isGatewayValid, isMetricValid, isSrcValid := true, true, true
+	// Path attributes are all optional numbers, track the invalid ones by field.
+	invalidAttrs := map[*components.InputField]bool{}
 	checkOverallValidation := func() {
-		if isDestValid && isGatewayValid {
+		if isDestValid && (isGatewayValid || isSpecialType) && (isSrcValid || isSpecialType) &&
+			isMetricValid && len(invalidAttrs) == 0 {
 			header.addButton.Enable()
 		} else {
 			header.addButton.Disable()
@@ -64,14 +145,74 @@ func NewAppHeader() *AppHeader {
 		isGatewayValid = isValid
 		checkOverallValidation()
 	}
+	header.metricInput.OnValidationChanged = func(isValid bool) {
+		isMetricValid = isValid
+		checkOverallValidation()
+	}
+	header.srcInput.OnValidationChanged = func(isValid bool) {
+		isSrcValid = isValid
+		checkOverallValidation()
+	}
+	for _, input := range []*components.InputField{header.mtuInput, header.advMSSInput, header.cwndInput, header.rwndInput} {
+		input.OnValidationChanged = func(isValid bool) {
+			if isValid {
+				delete(invalidAttrs, input)
+			} else {
+				invalidAttrs[input] = true
+			}
+			checkOverallValidation()
+		}
+	}
+	// The source address has to belong to the chosen interface.
+	interfaceChoice.View.OnChanged = func(string) {
+		header.srcInput.Revalidate()
+	}
+	// Blackhole, unreachable, prohibit and throw routes have no interface or gateway.
+	typeChoice.View.OnChanged = func(label string) {
+		isSpecialType = routemanager.IsSpecialType(routeTypeFromLabel(label))
+		if isSpecialType {
+			header.gatewayInput.Disable()
+			header.srcInput.Disable()
+			interfaceChoice.View.Disable()
+			onLinkCheckbox.View.Disable()
+		} else {
+			header.gatewayInput.Enable()
+			header.srcInput.Enable()
+			interfaceChoice.View.Enable()
+			onLinkCheckbox.View.Enable()
+		}
+		checkOverallValidation()
+	}
 
-	header.View = container.New(NewProportionalLayout(2, 5),
+	routeRow := container.New(NewProportionalLayout(2, 5),
 		header.destInput,
 		header.gatewayInput,
+		header.metricInput,
+		typeChoice.View,
 		interfaceChoice.View,
+		onLinkCheckbox.View,
 		saveCheckbox.View,
 		header.addButton,
 	)
+	metadataRow := container.New(NewProportionalLayout(2, 5),
+		header.descInput,
+		header.tagsInput,
+		lifetimeChoice.View,
+	)
+
+	// Rarely needed, so these stay folded away.
+	attributesRow := container.New(NewProportionalLayout(2, 5),
+		header.srcInput,
+		tableChoice.View,
+		header.mtuInput,
+		header.advMSSInput,
+		header.cwndInput,
+		header.rwndInput,
+		congestionChoice.View,
+	)
+	advanced := widget.NewAccordion(widget.NewAccordionItem("Table, source address and path attributes", attributesRow))
+
+	header.View = container.NewVBox(routeRow, metadataRow, advanced)
 
 	return header
 }
@@ -80,4 +221,64 @@ func NewAppHeader() *AppHeader {
 func (h *AppHeader) ClearFields() {
 	h.destInput.SetText("")
 	h.gatewayInput.SetText("")
+	h.metricInput.SetText("")
+	h.srcInput.SetText("")
+	h.mtuInput.SetText("")
+	h.advMSSInput.SetText("")
+	h.cwndInput.SetText("")
+	h.rwndInput.SetText("")
+	h.descInput.SetText("")
+	h.tagsInput.SetText("")
+}
+
+// RefreshInterfaces reloads the interface list, e.g. after switching to another namespace.
+func (h *AppHeader) RefreshInterfaces() {
+	labels := interfaceLabels(routemanager.GetInterfaceNames())
+	h.interfaceChoice.View.Options = labels
+	if len(labels) > 0 {
+		h.interfaceChoice.View.SetSelected(labels[0])
+	} else {
+		h.interfaceChoice.View.ClearSelected()
+	}
+}
+
+// routeLifetimes are the choices for how long an added route stays. The first one keeps it.
+var routeLifetimes = []struct {
+	label    string
+	lifetime time.Duration
+}{
+	{"Keep", 0},
+	{"Remove after 15 min", 15 * time.Minute},
+	{"Remove after 1 hour", time.Hour},
+	{"Remove after 4 hours", 4 * time.Hour},
+	{"Remove after 1 day", 24 * time.Hour},
+}
+
+func routeLifetime(label string) time.Duration {
+	for _, l := range routeLifetimes {
+		if l.label == label {
+			return l.lifetime
+		}
+	}
+	return 0
+}
+
+// tableID resolves a table picked from the list, which always has a known name.
+func tableID(name string) int {
+	id, err := routemanager.ParseTable(name)
+	if err != nil {
+		log.Printf("WARN: %v, using the main table", err)
+	}
+	return id
+}
+
+// parseTags splits a comma separated list into trimmed, non-empty tags.
+func parseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
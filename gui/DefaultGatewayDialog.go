@@ -0,0 +1,94 @@
+package gui
+
+import (
+	"route-manager/routemanager"
+	"route-manager/validators"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// prefProbeTarget remembers the host contacted after switching the default gateway.
+const prefProbeTarget = "defaultGateway.probeTarget"
+
+// Labels of the switch modes in the dialog, in the order of routemanager.SwitchMode.
+var switchModeLabels = []string{
+	"Prefer it, keep the others as fallback (lower metric)",
+	"Replace the other default routes",
+}
+
+// DefaultGatewayChoice is what the user picked in the default gateway dialog.
+type DefaultGatewayChoice struct {
+	Gateway     string
+	Interface   string
+	Mode        routemanager.SwitchMode
+	ProbeTarget string
+	Namespace   string // The namespace the choices were listed from
+}
+
+// ShowDefaultGatewaySwitcher asks which gateway should become the default route,
+// e.g. Ethernet instead of Wi-Fi, and how to check the network still works afterwards.
+func ShowDefaultGatewaySwitcher(parent fyne.Window, onSwitch func(choice DefaultGatewayChoice)) {
+	prefs := fyne.CurrentApp().Preferences()
+	namespace := routemanager.CurrentNamespace()
+
+	// The gateway follows the interface: suggest the one its current default route uses.
+	defaults := map[string]string{}
+	for _, r := range routemanager.ListSystemRoutes() {
+		if r.IsDefault() && r.Interface != "" {
+			defaults[r.Interface] = r.Gateway
+		}
+	}
+
+	gatewayEntry := widget.NewEntry()
+	gatewayEntry.SetPlaceHolder("e.g. 192.168.1.1")
+	gatewayEntry.Validator = validatorFor(validators.ValidateIP, "not a valid IP address")
+
+	interfaceSelect := widget.NewSelect(interfaceLabels(routemanager.GetInterfaceNames()), func(label string) {
+		if gw, ok := defaults[interfaceFromLabel(label)]; ok {
+			gatewayEntry.SetText(gw)
+		}
+	})
+
+	modeRadio := widget.NewRadioGroup(switchModeLabels, nil)
+	modeRadio.SetSelected(switchModeLabels[routemanager.SwitchByMetric])
+	modeRadio.Required = true
+
+	probeEntry := widget.NewEntry()
+	probeEntry.SetText(prefs.StringWithFallback(prefProbeTarget, routemanager.DefaultProbeTarget))
+	probeEntry.Validator = validatorFor(func(s string) bool { return s != "" }, "a probe target is required")
+
+	probeItem := widget.NewFormItem("Probe target", probeEntry)
+	probeItem.HintText = "host:port that must answer afterwards, otherwise the change is undone"
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Interface", interfaceSelect),
+		widget.NewFormItem("Gateway", gatewayEntry),
+		widget.NewFormItem("Mode", modeRadio),
+		probeItem,
+	}
+
+	form := dialog.NewForm("Switch Default Gateway", "Switch", "Cancel", items, func(confirm bool) {
+		if !confirm || interfaceSelect.Selected == "" {
+			return
+		}
+		probe := strings.TrimSpace(probeEntry.Text)
+		prefs.SetString(prefProbeTarget, probe)
+
+		mode := routemanager.SwitchByMetric
+		if modeRadio.Selected == switchModeLabels[routemanager.SwitchByReplace] {
+			mode = routemanager.SwitchByReplace
+		}
+		onSwitch(DefaultGatewayChoice{
+			Gateway:     strings.TrimSpace(gatewayEntry.Text),
+			Interface:   interfaceFromLabel(interfaceSelect.Selected),
+			Mode:        mode,
+			ProbeTarget: probe,
+			Namespace:   namespace,
+		})
+	}, parent)
+	form.Resize(fyne.NewSize(500, 0))
+	form.Show()
+}
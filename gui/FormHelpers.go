@@ -0,0 +1,175 @@
+package gui
+
+import (
+	"errors"
+	"route-manager/routemanager"
+	"route-manager/validators"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Helpers shared by the route forms.
+
+// validatorFor adapts one of our bool validators to Fyne's entry validation.
+func validatorFor(valid func(string) bool, message string) fyne.StringValidator {
+	return func(s string) error {
+		if !valid(strings.TrimSpace(s)) {
+			return errors.New(message)
+		}
+		return nil
+	}
+}
+
+// optionalInt shows 0 as an empty field, since 0 means "not set" for metrics and tables.
+func optionalInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// parseOptionalInt is the reverse of optionalInt. The entry validators
+// have already rejected anything that isn't a number.
+func parseOptionalInt(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// newOptionalUintEntry creates an entry for a number where 0 means "kernel default".
+func newOptionalUintEntry(n int) *widget.Entry {
+	entry := widget.NewEntry()
+	entry.SetText(optionalInt(n))
+	entry.SetPlaceHolder("kernel default")
+	entry.Validator = validatorFor(validators.ValidateOptionalUint, "must be a whole number")
+	return entry
+}
+
+// newTableEntry creates an entry for a routing table that suggests the named tables
+// and VRFs, but also takes any table number.
+func newTableEntry(table int) *widget.SelectEntry {
+	var names []string
+	for _, t := range routemanager.RoutingTables() {
+		names = append(names, t.Name)
+	}
+	entry := widget.NewSelectEntry(names)
+	if table != 0 {
+		entry.SetText(routemanager.TableName(table))
+	}
+	entry.SetPlaceHolder("main")
+	entry.Validator = func(s string) error {
+		_, err := routemanager.ParseTable(s)
+		return err
+	}
+	return entry
+}
+
+// routeTypeLabel names a route type for display; unicast routes have an empty type.
+func routeTypeLabel(routeType string) string {
+	if routeType == routemanager.TypeUnicast {
+		return "unicast"
+	}
+	return routeType
+}
+
+// routeTypeFromLabel is the reverse of routeTypeLabel.
+func routeTypeFromLabel(label string) string {
+	if label == "unicast" {
+		return routemanager.TypeUnicast
+	}
+	return label
+}
+
+// routeTypeLabels lists every creatable route type for a dropdown.
+func routeTypeLabels() []string {
+	labels := make([]string, len(routemanager.RouteTypes))
+	for i, t := range routemanager.RouteTypes {
+		labels[i] = routeTypeLabel(t)
+	}
+	return labels
+}
+
+// newRouteTypeSelect creates a route type dropdown. The forwarding widgets (interface,
+// gateway, ...) are disabled whenever a type that doesn't forward traffic is chosen.
+func newRouteTypeSelect(current string, forwarding ...fyne.Disableable) *widget.Select {
+	s := widget.NewSelect(routeTypeLabels(), func(label string) {
+		special := routemanager.IsSpecialType(routeTypeFromLabel(label))
+		for _, w := range forwarding {
+			if special {
+				w.Disable()
+			} else {
+				w.Enable()
+			}
+		}
+	})
+	s.SetSelected(routeTypeLabel(current))
+	return s
+}
+
+// setRouteType sets the type chosen in a form and drops the forwarding fields
+// that don't apply to it, so a blackhole route is never saved with a gateway.
+func setRouteType(route *routemanager.StaticRoute, label string) {
+	route.Type = routeTypeFromLabel(label)
+	if routemanager.IsSpecialType(route.Type) {
+		route.Interface = ""
+		route.Gateway = ""
+		route.OnLink = false
+		route.Src = ""
+		route.NextHops = nil
+	}
+}
+
+// interfaceLabel shows an interface with its alias, if it has one: "eth1 (Office dock)".
+func interfaceLabel(name string, aliases map[string]string) string {
+	if alias := aliases[name]; alias != "" {
+		return name + " (" + alias + ")"
+	}
+	return name
+}
+
+// interfaceLabels labels the interfaces of the current namespace for a dropdown.
+func interfaceLabels(names []string) []string {
+	aliases := routemanager.InterfaceAliases()
+	labels := make([]string, len(names))
+	for i, name := range names {
+		labels[i] = interfaceLabel(name, aliases)
+	}
+	return labels
+}
+
+// interfaceFromLabel is the reverse of interfaceLabel. Interface names have no spaces.
+func interfaceFromLabel(label string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(label), " ")
+	return name
+}
+
+// bindModes labels the ways a saved route can find its interface, see routemanager.BindMode.
+var bindModes = []struct {
+	mode  routemanager.BindMode
+	label string
+}{
+	{routemanager.BindByName, "Interface name"},
+	{routemanager.BindByMAC, "MAC address"},
+	{routemanager.BindByPermAddr, "Permanent hardware address"},
+	{routemanager.BindByAlias, "Alias"},
+}
+
+func bindModeLabel(mode routemanager.BindMode) string {
+	for _, m := range bindModes {
+		if m.mode == mode {
+			return m.label
+		}
+	}
+	return string(mode)
+}
+
+func bindModeFromLabel(label string) routemanager.BindMode {
+	for _, m := range bindModes {
+		if m.label == label {
+			return m.mode
+		}
+	}
+	return routemanager.BindByName
+}
@@ -32,13 +32,17 @@ func NewHelpSection() *HelpSection {
 			"Specific: 10.226.98.107/32 (Routes traffic for only the 10.226.98.107 host)",
 	)
 
-	// 3. Explanation of how to find an IP
+	// 3. Explanation of routes without a gateway
+	gatewayIntro := widget.NewLabel("Leave the Gateway empty for point-to-point links such as VPN tunnels (e.g. 10.8.0.0/16 on tun0): traffic is sent straight out of the interface. Tick On-link if the gateway is reachable on the interface but outside its subnet. A blackhole route silently drops traffic, e.g. to keep internal ranges off Wi-Fi when Ethernet is unplugged.")
+	gatewayIntro.Wrapping = fyne.TextWrapWord
+
+	// 4. Explanation of how to find an IP
 	findIpIntro := widget.NewLabel("If you only know a domain name (e.g., google.com), you can find its IP address using a terminal command:")
 	findIpIntro.Wrapping = fyne.TextWrapWord
 
 	findIpCommands := widget.NewLabel("ping google.com\nnslookup google.com")
 
-	// 4. Assemble all the help content in a vertical box
+	// 5. Assemble all the help content in a vertical box
 	helpContent := container.NewVBox(
 		subnetIntro,
 		subnetTable,
@@ -46,11 +50,13 @@ func NewHelpSection() *HelpSection {
 		destIntro,
 		destExamples,
 		widget.NewSeparator(),
+		gatewayIntro,
+		widget.NewSeparator(),
 		findIpIntro,
 		findIpCommands,
 	)
 
-	// 5. Create the Accordion item
+	// 6. Create the Accordion item
 	accordionItem := widget.NewAccordionItem(
 		"Need Help? Click to Expand Instructions",
 		helpContent,
@@ -0,0 +1,89 @@
+package gui
+
+import (
+	"route-manager/routemanager"
+	"route-manager/validators"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ShowLiveRouteEditor opens a form with every attribute of a route in the kernel.
+// The destination identifies the route and can't be changed here.
+// onApply receives the edited route; old is left untouched.
+func ShowLiveRouteEditor(old routemanager.StaticRoute, parent fyne.Window, onApply func(routemanager.StaticRoute)) {
+	gatewayEntry := widget.NewEntry()
+	gatewayEntry.SetText(old.Gateway)
+	gatewayEntry.SetPlaceHolder("none, device route")
+	gatewayEntry.Validator = validatorFor(validators.ValidateOptionalIP, "not a valid IP address")
+
+	onLinkCheck := widget.NewCheck("On-link (gateway outside the interface subnet)", nil)
+	onLinkCheck.SetChecked(old.OnLink)
+
+	interfaceSelect := widget.NewSelect(interfaceLabels(routemanager.GetInterfaceNames()), nil)
+	interfaceSelect.SetSelected(interfaceLabel(old.Interface, routemanager.InterfaceAliases()))
+
+	metricEntry := widget.NewEntry()
+	metricEntry.SetText(optionalInt(old.Metric))
+	metricEntry.SetPlaceHolder("kernel default")
+	metricEntry.Validator = validatorFor(validators.ValidateOptionalUint, "must be a whole number")
+
+	srcEntry := widget.NewEntry()
+	srcEntry.SetText(old.Src)
+	srcEntry.SetPlaceHolder("any")
+	srcEntry.Validator = validatorFor(validators.ValidateOptionalIP, "not a valid IP address")
+
+	tableEntry := newTableEntry(old.Table)
+
+	mtuEntry := newOptionalUintEntry(old.MTU)
+	advMSSEntry := newOptionalUintEntry(old.AdvMSS)
+	cwndEntry := newOptionalUintEntry(old.InitCwnd)
+	rwndEntry := newOptionalUintEntry(old.InitRwnd)
+	congestionEntry := widget.NewSelectEntry(routemanager.GetCongestionControls())
+	congestionEntry.SetText(old.Congestion)
+	congestionEntry.SetPlaceHolder("system default")
+
+	typeSelect := newRouteTypeSelect(old.Type, gatewayEntry, onLinkCheck, interfaceSelect, srcEntry)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Destination", widget.NewLabel(old.Destination)),
+		widget.NewFormItem("Type", typeSelect),
+		widget.NewFormItem("Gateway", gatewayEntry),
+		widget.NewFormItem("", onLinkCheck),
+		widget.NewFormItem("Interface", interfaceSelect),
+		widget.NewFormItem("Metric", metricEntry),
+		widget.NewFormItem("Source", srcEntry),
+		widget.NewFormItem("Table / VRF", tableEntry),
+		widget.NewFormItem("MTU", mtuEntry),
+		widget.NewFormItem("Advertised MSS", advMSSEntry),
+		widget.NewFormItem("Initial cwnd", cwndEntry),
+		widget.NewFormItem("Initial rwnd", rwndEntry),
+		widget.NewFormItem("Congestion control", congestionEntry),
+	}
+
+	form := dialog.NewForm("Edit Route", "Apply", "Cancel", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		edited := old
+		edited.Gateway = strings.TrimSpace(gatewayEntry.Text)
+		edited.OnLink = onLinkCheck.Checked && edited.Gateway != ""
+		edited.Interface = interfaceFromLabel(interfaceSelect.Selected)
+		edited.Metric = parseOptionalInt(metricEntry.Text)
+		edited.Src = strings.TrimSpace(srcEntry.Text)
+		edited.Table, _ = routemanager.ParseTable(tableEntry.Text) // Checked by the validator
+		edited.PathAttributes = routemanager.PathAttributes{
+			MTU:        parseOptionalInt(mtuEntry.Text),
+			AdvMSS:     parseOptionalInt(advMSSEntry.Text),
+			InitCwnd:   parseOptionalInt(cwndEntry.Text),
+			InitRwnd:   parseOptionalInt(rwndEntry.Text),
+			Congestion: strings.TrimSpace(congestionEntry.Text),
+		}
+		setRouteType(&edited, typeSelect.Selected)
+		onApply(edited)
+	}, parent)
+	form.Resize(fyne.NewSize(400, 0))
+	form.Show()
+}
@@ -0,0 +1,79 @@
+package gui
+
+import (
+	"route-manager/routemanager"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// hostNamespace is how the host's own namespace ("") is shown.
+const hostNamespace = "host"
+
+// NamespaceSelector picks the network namespace the whole window works in.
+// Named namespaces are offered, a container can be picked by typing pid:<pid>.
+type NamespaceSelector struct {
+	View fyne.CanvasObject
+
+	OnSelected func(namespace string) // "" for the host
+
+	entry   *widget.SelectEntry
+	options []string
+}
+
+// NewNamespaceSelector creates the selector, starting in the host's namespace.
+func NewNamespaceSelector() *NamespaceSelector {
+	s := &NamespaceSelector{}
+
+	s.entry = widget.NewSelectEntry(nil)
+	s.entry.SetText(hostNamespace)
+	s.entry.SetPlaceHolder("host, a name from /var/run/netns or pid:<pid>")
+	s.entry.OnSubmitted = func(string) { s.selected() }
+	s.reloadOptions()
+
+	// Picking from the dropdown selects right away, typing waits for Enter.
+	s.entry.OnChanged = func(text string) {
+		if slices.Contains(s.options, text) {
+			s.selected()
+		}
+	}
+
+	reloadButton := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), s.reloadOptions)
+	s.View = container.NewBorder(nil, nil, widget.NewLabel("Namespace:"), reloadButton, s.entry)
+	return s
+}
+
+// SetNamespace shows namespace as selected without reporting it.
+func (s *NamespaceSelector) SetNamespace(namespace string) {
+	onChanged := s.entry.OnChanged
+	s.entry.OnChanged = nil
+	s.entry.SetText(namespaceLabel(namespace))
+	s.entry.OnChanged = onChanged
+}
+
+func (s *NamespaceSelector) reloadOptions() {
+	s.options = append([]string{hostNamespace}, routemanager.ListNamespaces()...)
+	s.entry.SetOptions(s.options)
+}
+
+func (s *NamespaceSelector) selected() {
+	namespace := strings.TrimSpace(s.entry.Text)
+	if namespace == hostNamespace {
+		namespace = ""
+	}
+	if s.OnSelected != nil {
+		s.OnSelected(namespace)
+	}
+}
+
+// namespaceLabel shows the host's namespace by name instead of as an empty string.
+func namespaceLabel(namespace string) string {
+	if namespace == "" {
+		return hostNamespace
+	}
+	return namespace
+}
@@ -0,0 +1,52 @@
+package gui
+
+import (
+	"route-manager/routemanager"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// prefPendingExpiry remembers how long routes wait for a missing interface.
+const prefPendingExpiry = "pending.expiry"
+
+// pendingExpiries are the choices for how long a pending route waits. 0 waits until it is cancelled.
+var pendingExpiries = []struct {
+	label  string
+	expiry time.Duration
+}{
+	{"1 hour", time.Hour},
+	{"1 day", routemanager.DefaultPendingExpiry},
+	{"1 week", 7 * 24 * time.Hour},
+	{"no limit", 0},
+}
+
+// PendingExpiry returns how long a route may wait for its interface, as picked by the user.
+func PendingExpiry() time.Duration {
+	seconds := fyne.CurrentApp().Preferences().IntWithFallback(prefPendingExpiry, int(routemanager.DefaultPendingExpiry.Seconds()))
+	return time.Duration(seconds) * time.Second
+}
+
+// newPendingExpirySelect lets the user pick how long routes wait for a missing interface.
+func newPendingExpirySelect() *fyne.Container {
+	var labels []string
+	for _, e := range pendingExpiries {
+		labels = append(labels, e.label)
+	}
+	s := widget.NewSelect(labels, func(label string) {
+		for _, e := range pendingExpiries {
+			if e.label == label {
+				fyne.CurrentApp().Preferences().SetInt(prefPendingExpiry, int(e.expiry.Seconds()))
+			}
+		}
+	})
+	current := PendingExpiry()
+	for _, e := range pendingExpiries {
+		if e.expiry == current {
+			s.Selected = e.label
+		}
+	}
+	return container.NewHBox(widget.NewLabel("Missing interface: wait"), s)
+}
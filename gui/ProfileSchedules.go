@@ -0,0 +1,110 @@
+package gui
+
+import (
+	"fmt"
+	"route-manager/routemanager"
+	"slices"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// maxUpcoming is how many upcoming transitions the schedules dialog lists.
+const maxUpcoming = 10
+
+// ShowProfileSchedules lets the user give every tag of the saved routes, a profile,
+// its activation windows, and lists what the scheduler does next.
+// onSave receives a profile for every tag shown, with an empty schedule for those without one.
+func ShowProfileSchedules(parent fyne.Window, onSave func(profiles []routemanager.Profile)) {
+	routes, err := routemanager.LoadRoutes()
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+	profiles, err := routemanager.LoadProfiles()
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	// 1. ONE SCHEDULE PER TAG
+	var tags []string
+	for _, r := range routes {
+		for _, tag := range r.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+
+	intro := widget.NewLabel("Routes tagged with a profile are only active during its windows, " +
+		"unless they have windows of their own. Separate windows with \";\", " +
+		"e.g. \"mon-fri 09:00-18:00; 2026-11-07 02:00-04:00\".")
+	intro.Wrapping = fyne.TextWrapWord
+
+	form := widget.NewForm()
+	entries := make([]*widget.Entry, len(tags))
+	for i, tag := range tags {
+		entries[i] = widget.NewEntry()
+		entries[i].SetPlaceHolder("always")
+		for _, p := range profiles {
+			if p.Name == tag {
+				entries[i].SetText(p.ActiveDuring)
+			}
+		}
+		entries[i].Validator = func(text string) error {
+			_, err := routemanager.ParseWindows(text)
+			return err
+		}
+		form.Append(tag, entries[i])
+	}
+	if len(tags) == 0 {
+		form.Append("", widget.NewLabel("Tag saved routes to group them into profiles."))
+	}
+
+	// 2. WHAT HAPPENS NEXT
+	upcoming := widget.NewLabel(upcomingText())
+
+	content := container.NewVBox(intro, form,
+		widget.NewLabelWithStyle("Upcoming", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		upcoming,
+	)
+	d := dialog.NewCustomConfirm("Schedules", "Save", "Cancel", content, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		var edited []routemanager.Profile
+		for i, tag := range tags {
+			if entries[i].Validate() != nil {
+				dialog.ShowError(fmt.Errorf("the schedule of %s is invalid", tag), parent)
+				return
+			}
+			edited = append(edited, routemanager.Profile{Name: tag, ActiveDuring: strings.TrimSpace(entries[i].Text)})
+		}
+		onSave(edited)
+	}, parent)
+	d.Resize(fyne.NewSize(600, 0))
+	d.Show()
+}
+
+// upcomingText lists the next transitions of the scheduled routes, one per line.
+func upcomingText() string {
+	now := time.Now()
+	transitions, err := routemanager.UpcomingTransitions(now)
+	if err != nil {
+		return err.Error()
+	}
+	if len(transitions) == 0 {
+		return "No scheduled routes."
+	}
+	var lines []string
+	for _, t := range transitions[:min(len(transitions), maxUpcoming)] {
+		lines = append(lines, fmt.Sprintf("%s   %s", transitionText(t.Activate, t.At, now), t.Route))
+	}
+	return strings.Join(lines, "\n")
+}
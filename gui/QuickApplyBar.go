@@ -1,7 +1,6 @@
 package gui
 
 import (
-	"fmt"
 	"log"
 	"route-manager/gui/components"
 	"route-manager/routemanager"
@@ -77,9 +76,6 @@ func (b *QuickApplyBar) Refresh() {
 		return
 	}
 
-	if len(routes) > 10 {
-		routes = routes[len(routes)-10:]
-	}
 	b.routes = routes
 
 	var options []string
@@ -108,5 +104,18 @@ func (b *QuickApplyBar) Refresh() {
 
 // formatRoute is a helper to create a consistent display string for a route.
 func formatRoute(r routemanager.StaticRoute) string {
-	return fmt.Sprintf("%s via %s (dev %s)", r.Destination, r.Gateway, r.Interface)
+	text := r.String()
+	if r.Namespace != "" {
+		text += " (netns " + r.Namespace + ")"
+	}
+	if r.Description != "" {
+		text += " — " + r.Description
+	}
+	if r.Source == routemanager.SourceSystem {
+		text += " [system]"
+	}
+	if !r.Enabled() {
+		text += " [disabled]"
+	}
+	return text
 }
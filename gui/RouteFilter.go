@@ -0,0 +1,108 @@
+package gui
+
+import (
+	"net"
+	"route-manager/routemanager"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+)
+
+// allOption is the first choice of every filter dropdown and disables that filter.
+const allOption = "All"
+
+// routeFilter holds the state of the filter controls above the live route table.
+type routeFilter struct {
+	Query      string
+	Interface  string
+	Protocol   string
+	Table      string
+	OnlyStatic bool
+	ShowLocal  bool // Show the local table and local/broadcast routes
+}
+
+// Preference keys used to remember the filter between runs.
+const (
+	prefFilterQuery      = "routeTable.filter.query"
+	prefFilterInterface  = "routeTable.filter.interface"
+	prefFilterProtocol   = "routeTable.filter.protocol"
+	prefFilterTable      = "routeTable.filter.table"
+	prefFilterOnlyStatic = "routeTable.filter.onlyStatic"
+	prefFilterShowLocal  = "routeTable.filter.showLocal"
+	prefSortColumn       = "routeTable.sort.column"
+	prefSortAscending    = "routeTable.sort.ascending"
+)
+
+// loadRouteFilter reads the filter saved by the previous session.
+func loadRouteFilter(prefs fyne.Preferences) routeFilter {
+	return routeFilter{
+		Query:      prefs.String(prefFilterQuery),
+		Interface:  prefs.StringWithFallback(prefFilterInterface, allOption),
+		Protocol:   prefs.StringWithFallback(prefFilterProtocol, allOption),
+		Table:      prefs.StringWithFallback(prefFilterTable, allOption),
+		OnlyStatic: prefs.Bool(prefFilterOnlyStatic),
+		ShowLocal:  prefs.Bool(prefFilterShowLocal),
+	}
+}
+
+func (f routeFilter) save(prefs fyne.Preferences) {
+	prefs.SetString(prefFilterQuery, f.Query)
+	prefs.SetString(prefFilterInterface, f.Interface)
+	prefs.SetString(prefFilterProtocol, f.Protocol)
+	prefs.SetString(prefFilterTable, f.Table)
+	prefs.SetBool(prefFilterOnlyStatic, f.OnlyStatic)
+	prefs.SetBool(prefFilterShowLocal, f.ShowLocal)
+}
+
+// matches reports whether a live route passes every active filter.
+func (f routeFilter) matches(r routemanager.SystemRoute) bool {
+	if f.OnlyStatic && !r.IsStatic {
+		return false
+	}
+	if f.Interface != allOption && f.Interface != "" && !slices.Contains(routeInterfaces(r), f.Interface) {
+		return false
+	}
+	if f.Protocol != allOption && f.Protocol != "" && r.Protocol != f.Protocol {
+		return false
+	}
+	if f.Table != allOption && f.Table != "" {
+		if routemanager.TableName(r.Table) != f.Table {
+			return false
+		}
+	} else if !f.ShowLocal && isLocalRoute(r) {
+		// Choosing the local table in the dropdown shows it regardless.
+		return false
+	}
+	return matchesQuery(r, f.Query)
+}
+
+// isLocalRoute reports whether a route only describes the host's own addresses,
+// which clutter the list and can't be meaningfully edited.
+func isLocalRoute(r routemanager.SystemRoute) bool {
+	return routemanager.IsHiddenTable(r.Table) || r.Type == "local" || r.Type == "broadcast"
+}
+
+// matchesQuery does a substring match on destination and gateway. If the query is
+// a plain IP address it also matches every route whose destination contains it,
+// so "10.226.98.107" finds the 10.226.0.0/16 route that would carry the traffic.
+func matchesQuery(r routemanager.SystemRoute, query string) bool {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return true
+	}
+	if strings.Contains(r.Destination, query) || strings.Contains(r.Gateway, query) {
+		return true
+	}
+	for _, hop := range r.NextHops {
+		if strings.Contains(hop.Gateway, query) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(query); ip != nil {
+		if _, dst, err := net.ParseCIDR(r.Destination); err == nil && dst.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
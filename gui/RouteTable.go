@@ -1,59 +1,184 @@
 package gui
 
 import (
+	"cmp"
+	"fmt"
 	"image/color"
+	"log"
+	"net"
 	"route-manager/routemanager"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
 type RouteTable struct {
 	widget.BaseWidget
-	OnDelete func(route routemanager.StaticRoute)
+	OnDelete func(routes []routemanager.StaticRoute)
+	OnSave   func(routes []routemanager.StaticRoute)
+	OnEdit   func(route routemanager.StaticRoute)
+	// OnSwitchDefault opens the guarded switch of the default gateway. Default
+	// routes can't be deleted or edited in the table itself.
+	OnSwitchDefault func()
 
-	table          *widget.Table
-	deleteButton   *widget.Button
-	filterCheck    *widget.Check
-	allRoutes      []routemanager.SystemRoute
-	filteredRoutes []routemanager.SystemRoute
-	selectedID     int // Index in filteredRoutes, adjusted for header
+	table           *widget.Table
+	deleteButton    *widget.Button
+	editButton      *widget.Button
+	saveButton      *widget.Button
+	copyButton      *widget.Button
+	filterCheck     *widget.Check
+	localCheck      *widget.Check
+	searchEntry     *widget.Entry
+	interfaceSelect *widget.Select
+	protocolSelect  *widget.Select
+	tableSelect     *widget.Select
+	filter          routeFilter
+	sortColumn      int
+	sortAsc         bool
+	allRoutes       []routemanager.SystemRoute
+	filteredRoutes  []routemanager.SystemRoute
+	rows            []routeRow                 // filteredRoutes with the next hops of expanded routes
+	expanded        map[string]bool            // Multipath routes showing their next hops, keyed by liveRouteKey
+	savedRoutes     []routemanager.StaticRoute // Used to show descriptions of saved routes
+	aliases         map[string]string          // Interface aliases, keyed by interface name
+	selected        map[string]bool            // Keyed by liveRouteKey
+	anchor          int                        // Index in rows that shift-click extends from
+
+	schedule []routemanager.TemporaryRoute // Temporary routes, for the countdown
+}
+
+// routeColumn describes one column of the live route table.
+type routeColumn struct {
+	header  string
+	width   float32
+	text    func(t *RouteTable, r routemanager.SystemRoute) string
+	compare func(a, b routemanager.SystemRoute) int // nil sorts by text
+	hopText func(hop routemanager.NextHop) string   // Text in the expanded rows of a multipath route
+}
+
+// routeRow is one line of the table: a route, or one next hop of an expanded multipath route.
+type routeRow struct {
+	route routemanager.SystemRoute
+	hop   int // Index into route.NextHops, or -1 for the route itself
+}
+
+var routeColumns = []routeColumn{
+	{header: "Destination", width: 200, text: (*RouteTable).destinationText,
+		compare: func(a, b routemanager.SystemRoute) int { return compareAddresses(a.Destination, b.Destination) },
+		hopText: func(routemanager.NextHop) string { return "    ↳ next hop" }},
+	{header: "Type", width: 100,
+		text: func(_ *RouteTable, r routemanager.SystemRoute) string { return routeTypeLabel(r.Type) }},
+	{header: "Gateway", width: 160,
+		text:    func(_ *RouteTable, r routemanager.SystemRoute) string { return gatewayText(r) },
+		compare: func(a, b routemanager.SystemRoute) int { return compareAddresses(a.Gateway, b.Gateway) },
+		hopText: func(hop routemanager.NextHop) string { return hop.Gateway }},
+	{header: "Interface", width: 120,
+		text:    (*RouteTable).interfaceText,
+		hopText: func(hop routemanager.NextHop) string { return hop.Interface }},
+	{header: "Metric", width: 70,
+		text:    func(_ *RouteTable, r routemanager.SystemRoute) string { return strconv.Itoa(r.Metric) },
+		compare: func(a, b routemanager.SystemRoute) int { return cmp.Compare(a.Metric, b.Metric) },
+		hopText: func(hop routemanager.NextHop) string { return fmt.Sprintf("weight %d", hop.Weight) }},
+	{header: "Protocol", width: 90,
+		text: func(_ *RouteTable, r routemanager.SystemRoute) string { return r.Protocol }},
+	{header: "Table", width: 90,
+		text:    func(_ *RouteTable, r routemanager.SystemRoute) string { return routemanager.TableName(r.Table) },
+		compare: func(a, b routemanager.SystemRoute) int { return cmp.Compare(a.Table, b.Table) }},
+	{header: "Source", width: 120,
+		text:    func(_ *RouteTable, r routemanager.SystemRoute) string { return r.Src },
+		compare: func(a, b routemanager.SystemRoute) int { return compareAddresses(a.Src, b.Src) }},
+	{header: "Attributes", width: 200,
+		text: func(_ *RouteTable, r routemanager.SystemRoute) string { return r.PathAttributes.Summary() }},
+	{header: "Expires In", width: 90,
+		text: (*RouteTable).expiresText},
+	{header: "Description", width: 300,
+		text: func(t *RouteTable, r routemanager.SystemRoute) string { return t.descriptionFor(r) }},
 }
 
 func NewRouteTable() *RouteTable {
-	t := &RouteTable{selectedID: -1}
+	t := &RouteTable{selected: map[string]bool{}, expanded: map[string]bool{}, anchor: -1}
 	t.ExtendBaseWidget(t)
 	return t
 }
 
 func (t *RouteTable) CreateRenderer() fyne.WidgetRenderer {
+	// 0. RESTORE THE FILTER FROM THE PREVIOUS SESSION
+	prefs := fyne.CurrentApp().Preferences()
+	t.filter = loadRouteFilter(prefs)
+	t.sortColumn = prefs.Int(prefSortColumn)
+	if t.sortColumn < 0 || t.sortColumn >= len(routeColumns) {
+		t.sortColumn = 0
+	}
+	t.sortAsc = prefs.BoolWithFallback(prefSortAscending, true)
+
 	// 1. CREATE CONTROLS
 	t.filterCheck = widget.NewCheck("Show only static routes", func(checked bool) {
-		t.applyFilter(checked)
+		t.filter.OnlyStatic = checked
+		t.applyFilter()
 	})
+	t.filterCheck.Checked = t.filter.OnlyStatic
+	t.localCheck = widget.NewCheck("Show local and broadcast routes", func(checked bool) {
+		t.filter.ShowLocal = checked
+		t.applyFilter()
+	})
+	t.localCheck.Checked = t.filter.ShowLocal
 
-	t.deleteButton = widget.NewButtonWithIcon("Delete Selected Route", theme.DeleteIcon(), func() {
-		if t.selectedID >= 0 && t.OnDelete != nil {
-			routeToDelete := t.filteredRoutes[t.selectedID]
-			staticRoute := routemanager.StaticRoute{
-				Interface:   routeToDelete.Interface,
-				Destination: routeToDelete.Destination,
-				Gateway:     routeToDelete.Gateway,
-			}
-			t.OnDelete(staticRoute)
+	t.searchEntry = widget.NewEntry()
+	t.searchEntry.SetPlaceHolder("Filter by destination or gateway, or type an IP to find the routes covering it")
+	t.searchEntry.Text = t.filter.Query
+	t.searchEntry.OnChanged = func(text string) {
+		t.filter.Query = text
+		t.applyFilter()
+	}
+
+	t.interfaceSelect = t.newFilterSelect("Interface", &t.filter.Interface)
+	t.protocolSelect = t.newFilterSelect("Protocol", &t.filter.Protocol)
+	t.tableSelect = t.newFilterSelect("Table", &t.filter.Table)
+
+	t.deleteButton = widget.NewButtonWithIcon("Delete Selected", theme.DeleteIcon(), func() {
+		if t.OnDelete != nil {
+			t.OnDelete(t.SelectedRoutes())
+		}
+	})
+	t.editButton = widget.NewButtonWithIcon("Edit", theme.DocumentCreateIcon(), func() {
+		selected := t.SelectedRoutes()
+		if len(selected) == 1 && t.OnEdit != nil {
+			t.OnEdit(selected[0])
+		}
+	})
+	t.saveButton = widget.NewButtonWithIcon("Save Selected", theme.DocumentSaveIcon(), func() {
+		if t.OnSave != nil {
+			t.OnSave(t.SelectedRoutes())
+		}
+	})
+	switchDefaultButton := widget.NewButtonWithIcon("Switch Default Gateway…", theme.ViewRefreshIcon(), func() {
+		if t.OnSwitchDefault != nil {
+			t.OnSwitchDefault()
+		}
+	})
+	t.copyButton = widget.NewButtonWithIcon("Copy Selected", theme.ContentCopyIcon(), func() {
+		var lines []string
+		for _, r := range t.SelectedRoutes() {
+			lines = append(lines, r.String())
 		}
+		fyne.CurrentApp().Clipboard().SetContent(strings.Join(lines, "\n"))
 	})
-	t.deleteButton.Disable()
+	t.updateButtons()
 
 	// 2. BUILD THE TABLE WITH AN INTEGRATED HEADER
-	headers := []string{"Destination", "Gateway", "Interface", "Protocol"}
 	t.table = &widget.Table{
 		Length: func() (int, int) {
 			// Add 1 to the row count for our header row
-			return len(t.filteredRoutes) + 1, len(headers)
+			return len(t.rows) + 1, len(routeColumns)
 		},
 		CreateCell: func() fyne.CanvasObject {
 			return container.NewStack(
@@ -67,27 +192,17 @@ func (t *RouteTable) CreateRenderer() fyne.WidgetRenderer {
 			label := stack.Objects[1].(*widget.Label)
 
 			if id.Row == 0 { // This is the HEADER row
-				label.SetText(headers[id.Col])
+				label.SetText(sortedHeaderText(routeColumns[id.Col].header, id.Col == t.sortColumn, t.sortAsc))
 				label.TextStyle.Bold = true
 				bg.FillColor = color.Transparent
 			} else { // These are DATA rows
-				route := t.filteredRoutes[id.Row-1] // Adjust index for header
+				row := t.rows[id.Row-1] // Adjust index for header
+				route := row.route
 				label.TextStyle.Bold = false
-				var text string
-				switch id.Col {
-				case 0:
-					text = route.Destination
-				case 1:
-					text = route.Gateway
-				case 2:
-					text = route.Interface
-				case 3:
-					text = route.Protocol
-				}
-				label.SetText(text)
+				label.SetText(t.rowText(row, routeColumns[id.Col]))
 
 				// Visual selection logic
-				if (id.Row - 1) == t.selectedID {
+				if t.selected[liveRouteKey(route)] {
 					bg.FillColor = theme.FocusColor()
 				} else {
 					bg.FillColor = color.Transparent
@@ -97,61 +212,401 @@ func (t *RouteTable) CreateRenderer() fyne.WidgetRenderer {
 			label.Refresh()
 		},
 		OnSelected: func(id widget.TableCellID) {
-			if id.Row == 0 { // Don't allow selecting the header
-				t.table.UnselectAll()
-				t.selectedID = -1
-				t.deleteButton.Disable()
+			// The table only reports clicks; the multi-row selection lives in t.selected.
+			t.table.UnselectAll()
+			if id.Row == 0 { // Clicking a header sorts by that column
+				t.sortBy(id.Col)
 				return
 			}
-			t.selectedID = id.Row - 1 // Adjust index for header
-			if t.filteredRoutes[t.selectedID].IsStatic {
-				t.deleteButton.Enable()
-			} else {
-				t.deleteButton.Disable()
+			row := t.rows[id.Row-1] // Adjust index for header
+			if id.Col == 0 && row.hop < 0 && len(row.route.NextHops) > 0 {
+				// The destination of a multipath route expands or collapses its next hops.
+				t.toggleExpanded(row.route)
+				return
 			}
-			t.table.Refresh()
+			t.selectRow(id.Row-1, currentModifiers())
 		},
 	}
 	// These widths now apply to both the "header" and data cells perfectly
-	t.table.SetColumnWidth(0, 250)
-	t.table.SetColumnWidth(1, 200)
-	t.table.SetColumnWidth(2, 150)
-	t.table.SetColumnWidth(3, 100)
+	for i, col := range routeColumns {
+		t.table.SetColumnWidth(i, col.width)
+	}
 
 	// 3. ASSEMBLE THE FINAL LAYOUT
-	controlBar := container.NewHBox(t.deleteButton, t.filterCheck)
+	controlBar := container.NewHBox(t.deleteButton, t.editButton, t.saveButton, t.copyButton, switchDefaultButton, t.filterCheck, t.localCheck)
+	filterBar := container.NewBorder(nil, nil, nil,
+		container.NewHBox(t.interfaceSelect, t.protocolSelect, t.tableSelect),
+		t.searchEntry,
+	)
 
 	// Use a VBox to stack the controls above the table
-	content := container.NewBorder(controlBar, nil, nil, nil, t.table)
+	content := container.NewBorder(container.NewVBox(controlBar, filterBar), nil, nil, nil, t.table)
 
 	t.Refresh()
+	go t.tickCountdown()
 	return widget.NewSimpleRenderer(content)
 }
 
 // Refresh and applyFilter methods are adjusted to handle the new selection logic
 func (t *RouteTable) Refresh() {
 	t.allRoutes = routemanager.ListSystemRoutes()
-	t.table.UnselectAll()
-	t.selectedID = -1
-	t.deleteButton.Disable()
-	t.applyFilter(t.filterCheck.Checked)
+	saved, err := routemanager.LoadRoutes()
+	if err != nil {
+		log.Printf("ERROR: Failed to load saved routes: %v", err)
+	}
+	// Bound routes are matched by the name their interface has right now.
+	t.savedRoutes = routemanager.ResolveBindings(saved)
+	t.aliases = routemanager.InterfaceAliases()
+	if t.schedule, err = routemanager.LoadSchedule(); err != nil {
+		log.Printf("ERROR: Failed to load temporary routes: %v", err)
+	}
+
+	// The dropdowns offer only the values that actually occur in the table,
+	// except for tables: empty ones are offered too, so the user can see they are empty.
+	var interfaces, protocols, tables []string
+	for _, table := range routemanager.RoutingTables() {
+		tables = append(tables, table.Name)
+	}
+	for _, r := range t.allRoutes {
+		interfaces = append(interfaces, routeInterfaces(r)...)
+		protocols = append(protocols, r.Protocol)
+		tables = append(tables, routemanager.TableName(r.Table))
+	}
+	setFilterOptions(t.interfaceSelect, interfaces, t.filter.Interface)
+	setFilterOptions(t.protocolSelect, protocols, t.filter.Protocol)
+	setFilterOptions(t.tableSelect, tables, t.filter.Table)
+
+	t.applyFilter()
 }
 
-func (t *RouteTable) applyFilter(onlyStatic bool) {
-	t.table.UnselectAll() // Clear selection when filtering
-	t.selectedID = -1
-	t.deleteButton.Disable()
+func (t *RouteTable) applyFilter() {
+	t.filter.save(fyne.CurrentApp().Preferences())
 
-	if !onlyStatic {
-		t.filteredRoutes = t.allRoutes
-	} else {
-		var filtered []routemanager.SystemRoute
-		for _, r := range t.allRoutes {
-			if r.IsStatic {
-				filtered = append(filtered, r)
+	var filtered []routemanager.SystemRoute
+	for _, r := range t.allRoutes {
+		if t.filter.matches(r) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	col, asc := t.sortColumn, t.sortAsc
+	sort.SliceStable(filtered, func(i, j int) bool {
+		c := t.compareRoutes(filtered[i], filtered[j], routeColumns[col])
+		if asc {
+			return c < 0
+		}
+		return c > 0
+	})
+
+	t.filteredRoutes = filtered
+	t.buildRows()
+
+	// Routes hidden by the filter or gone from the kernel drop out of the selection,
+	// so bulk actions never touch something the user can't see.
+	visible := map[string]bool{}
+	for _, r := range filtered {
+		visible[liveRouteKey(r)] = true
+	}
+	for key := range t.selected {
+		if !visible[key] {
+			delete(t.selected, key)
+		}
+	}
+	t.anchor = -1
+
+	t.updateButtons()
+	t.table.Refresh()
+}
+
+// selectRow updates the selection like a file manager does: a plain click selects
+// one row, ctrl-click toggles a row and shift-click selects a range from the last click.
+func (t *RouteTable) selectRow(row int, mods fyne.KeyModifier) {
+	key := liveRouteKey(t.rows[row].route)
+	switch {
+	case mods&fyne.KeyModifierShift != 0 && t.anchor >= 0:
+		clear(t.selected)
+		from, to := min(t.anchor, row), max(t.anchor, row)
+		for i := from; i <= to; i++ {
+			t.selected[liveRouteKey(t.rows[i].route)] = true
+		}
+		// The anchor stays put so the range can be extended or shrunk.
+	case mods&(fyne.KeyModifierControl|fyne.KeyModifierSuper) != 0:
+		if t.selected[key] {
+			delete(t.selected, key)
+		} else {
+			t.selected[key] = true
+		}
+		t.anchor = row
+	default:
+		clear(t.selected)
+		t.selected[key] = true
+		t.anchor = row
+	}
+	t.updateButtons()
+	t.table.Refresh()
+}
+
+// buildRows lays out the filtered routes, inserting the next hops of every
+// expanded multipath route right below it.
+func (t *RouteTable) buildRows() {
+	t.rows = t.rows[:0]
+	for _, r := range t.filteredRoutes {
+		t.rows = append(t.rows, routeRow{route: r, hop: -1})
+		if t.expanded[liveRouteKey(r)] {
+			for i := range r.NextHops {
+				t.rows = append(t.rows, routeRow{route: r, hop: i})
 			}
 		}
-		t.filteredRoutes = filtered
 	}
+}
+
+func (t *RouteTable) toggleExpanded(route routemanager.SystemRoute) {
+	key := liveRouteKey(route)
+	t.expanded[key] = !t.expanded[key]
+	t.buildRows()
+	t.anchor = -1 // Row indices moved
 	t.table.Refresh()
 }
+
+// rowText returns the text of a cell, for a route or for one of its next hops.
+func (t *RouteTable) rowText(row routeRow, col routeColumn) string {
+	if row.hop < 0 {
+		return col.text(t, row.route)
+	}
+	if col.hopText == nil {
+		return ""
+	}
+	return col.hopText(row.route.NextHops[row.hop])
+}
+
+// destinationText marks multipath routes with an expand/collapse arrow.
+func (t *RouteTable) destinationText(r routemanager.SystemRoute) string {
+	if len(r.NextHops) == 0 {
+		return r.Destination
+	}
+	if t.expanded[liveRouteKey(r)] {
+		return "▼ " + r.Destination
+	}
+	return "▶ " + r.Destination
+}
+
+func (t *RouteTable) selectionHasMultipath() bool {
+	for _, r := range t.SelectedRoutes() {
+		if r.IsMultipath() {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectedRoutes returns the selected live routes in display order.
+func (t *RouteTable) SelectedRoutes() []routemanager.StaticRoute {
+	var routes []routemanager.StaticRoute
+	for _, r := range t.filteredRoutes {
+		if t.selected[liveRouteKey(r)] {
+			routes = append(routes, toStaticRoute(r))
+		}
+	}
+	return routes
+}
+
+// updateButtons enables the bulk actions that make sense for the current selection.
+// Deleting is only offered when every selected route is one we are allowed to delete.
+func (t *RouteTable) updateButtons() {
+	count, deletable := 0, true
+	for _, r := range t.filteredRoutes {
+		if t.selected[liveRouteKey(r)] {
+			count++
+			deletable = deletable && r.IsStatic && !r.IsDefault()
+		}
+	}
+	setEnabled(t.deleteButton, count > 0 && deletable)
+	setEnabled(t.editButton, count == 1 && deletable && !t.selectionHasMultipath())
+	setEnabled(t.saveButton, count > 0)
+	setEnabled(t.copyButton, count > 0)
+}
+
+// sortBy sorts by the given column, or flips the direction if it's already the sort column.
+func (t *RouteTable) sortBy(col int) {
+	if t.sortColumn == col {
+		t.sortAsc = !t.sortAsc
+	} else {
+		t.sortColumn, t.sortAsc = col, true
+	}
+	prefs := fyne.CurrentApp().Preferences()
+	prefs.SetInt(prefSortColumn, t.sortColumn)
+	prefs.SetBool(prefSortAscending, t.sortAsc)
+	t.applyFilter()
+}
+
+// compareRoutes orders two routes by a column. Destinations and gateways are compared
+// as addresses rather than as text, so 10.0.0.0/8 sorts before 192.168.0.0/16.
+func (t *RouteTable) compareRoutes(a, b routemanager.SystemRoute, col routeColumn) int {
+	if col.compare != nil {
+		return col.compare(a, b)
+	}
+	return strings.Compare(col.text(t, a), col.text(t, b))
+}
+
+// expiresText counts down the time a temporary route has left.
+func (t *RouteTable) expiresText(r routemanager.SystemRoute) string {
+	expiresAt, ok := routemanager.ExpiryFor(t.schedule, r)
+	if !ok {
+		return ""
+	}
+	left := time.Until(expiresAt).Round(time.Second)
+	if left <= 0 {
+		return "expiring"
+	}
+	return left.String()
+}
+
+// tickCountdown redraws the table every second while temporary routes are shown.
+func (t *RouteTable) tickCountdown() {
+	for range time.Tick(time.Second) {
+		fyne.Do(func() {
+			if len(t.schedule) > 0 {
+				t.table.Refresh()
+			}
+		})
+	}
+}
+
+// interfaceText lists the interfaces of a route, with their aliases.
+func (t *RouteTable) interfaceText(r routemanager.SystemRoute) string {
+	var labels []string
+	for _, name := range routeInterfaces(r) {
+		labels = append(labels, interfaceLabel(name, t.aliases))
+	}
+	return strings.Join(labels, ", ")
+}
+
+// descriptionFor returns the description of the saved route matching a live route, if any.
+func (t *RouteTable) descriptionFor(route routemanager.SystemRoute) string {
+	for _, saved := range t.savedRoutes {
+		if saved.Matches(route) {
+			return saved.Description
+		}
+	}
+	return ""
+}
+
+// newFilterSelect creates a dropdown that writes its choice into target and re-filters.
+func (t *RouteTable) newFilterSelect(placeholder string, target *string) *widget.Select {
+	s := widget.NewSelect([]string{allOption}, func(choice string) {
+		*target = choice
+		t.applyFilter()
+	})
+	s.PlaceHolder = placeholder
+	s.Selected = *target
+	return s
+}
+
+// setFilterOptions replaces the choices of a filter dropdown, keeping the current choice
+// even if no route matches it right now (e.g. an interface that is down).
+func setFilterOptions(s *widget.Select, values []string, current string) {
+	slices.Sort(values)
+	values = slices.Compact(values)
+	options := append([]string{allOption}, values...)
+	if current != "" && !slices.Contains(options, current) {
+		options = append(options, current)
+	}
+	s.Options = options
+	s.Refresh()
+}
+
+// sortedHeaderText adds an arrow to the header of the column the table is sorted by.
+func sortedHeaderText(header string, sorted, ascending bool) string {
+	if !sorted {
+		return header
+	}
+	if ascending {
+		return header + " ▲"
+	}
+	return header + " ▼"
+}
+
+// compareAddresses compares two IPs or CIDRs numerically, falling back to text.
+func compareAddresses(a, b string) int {
+	ipA, ipB := parseAddress(a), parseAddress(b)
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	if c := slices.Compare(ipA.To16(), ipB.To16()); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b) // Same address, order by prefix length
+}
+
+func parseAddress(s string) net.IP {
+	if ip, _, err := net.ParseCIDR(s); err == nil {
+		return ip
+	}
+	return net.ParseIP(s)
+}
+
+// liveRouteKey identifies a live route across refreshes, filtering and sorting.
+func liveRouteKey(r routemanager.SystemRoute) string {
+	return strings.Join([]string{r.Type, r.Destination, r.Gateway, r.Interface, strconv.Itoa(r.Metric), routemanager.TableName(r.Table)}, "|")
+}
+
+func toStaticRoute(r routemanager.SystemRoute) routemanager.StaticRoute {
+	table := r.Table
+	if table == routemanager.MainTable {
+		table = 0 // Saved routes leave the main table implicit
+	}
+	return routemanager.StaticRoute{
+		Type:           r.Type,
+		NextHops:       r.NextHops,
+		Interface:      r.Interface,
+		Destination:    r.Destination,
+		Gateway:        r.Gateway,
+		OnLink:         r.OnLink,
+		Metric:         r.Metric,
+		Src:            r.Src,
+		Table:          table,
+		Namespace:      r.Namespace,
+		PathAttributes: r.PathAttributes,
+	}
+}
+
+// currentModifiers returns the modifier keys held down right now, if the driver knows them.
+func currentModifiers() fyne.KeyModifier {
+	if d, ok := fyne.CurrentApp().Driver().(desktop.Driver); ok {
+		return d.CurrentKeyModifiers()
+	}
+	return 0
+}
+
+func setEnabled(b *widget.Button, enabled bool) {
+	if enabled {
+		b.Enable()
+	} else {
+		b.Disable()
+	}
+}
+
+// gatewayText summarizes the gateways of a route; multipath routes list theirs in the expanded rows.
+func gatewayText(r routemanager.SystemRoute) string {
+	if len(r.NextHops) > 0 {
+		return fmt.Sprintf("%d next hops", len(r.NextHops))
+	}
+	return r.Gateway
+}
+
+// routeInterfaces returns the interfaces a route sends traffic through.
+func routeInterfaces(r routemanager.SystemRoute) []string {
+	if len(r.NextHops) == 0 {
+		if r.Interface == "" {
+			return nil // Blackhole and other special routes
+		}
+		return []string{r.Interface}
+	}
+	var names []string
+	for _, hop := range r.NextHops {
+		if !slices.Contains(names, hop.Interface) {
+			names = append(names, hop.Interface)
+		}
+	}
+	return names
+}
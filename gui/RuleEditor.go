@@ -0,0 +1,111 @@
+package gui
+
+import (
+	"fmt"
+	"route-manager/routemanager"
+	"route-manager/validators"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ShowRuleEditor opens a form for a policy routing rule. For a new rule the user
+// can also choose whether to save it. onSave receives the edited copy, with the ID
+// of the original.
+func ShowRuleEditor(rule routemanager.Rule, isNew bool, parent fyne.Window, onSave func(rule routemanager.Rule, save bool)) {
+	priorityEntry := widget.NewEntry()
+	priorityEntry.SetText(optionalInt(rule.Priority))
+	priorityEntry.SetPlaceHolder("kernel default, just above the main table")
+	priorityEntry.Validator = validatorFor(validators.ValidateOptionalUint, "must be a whole number")
+
+	fromEntry := newPrefixEntry(rule.From)
+	toEntry := newPrefixEntry(rule.To)
+
+	fwMarkEntry := widget.NewEntry()
+	if rule.FwMark != 0 {
+		fwMarkEntry.SetText(fmt.Sprintf("%#x", rule.FwMark))
+		if rule.FwMask != 0 {
+			fwMarkEntry.SetText(fmt.Sprintf("%#x/%#x", rule.FwMark, rule.FwMask))
+		}
+	}
+	fwMarkEntry.SetPlaceHolder("any, e.g. 0x10 or 0x10/0xff")
+	fwMarkEntry.Validator = func(s string) error {
+		_, _, err := routemanager.ParseFwMark(s)
+		return err
+	}
+
+	interfaces := routemanager.GetInterfaceNames()
+	iifEntry := widget.NewSelectEntry(interfaces)
+	iifEntry.SetText(rule.Iif)
+	iifEntry.SetPlaceHolder("any")
+	oifEntry := widget.NewSelectEntry(interfaces)
+	oifEntry.SetText(rule.Oif)
+	oifEntry.SetPlaceHolder("any")
+
+	uidEntry := widget.NewEntry()
+	if rule.UIDRange != nil {
+		uidEntry.SetText(fmt.Sprintf("%d-%d", rule.UIDRange.Start, rule.UIDRange.End))
+	}
+	uidEntry.SetPlaceHolder("any user, e.g. 1000 or 1000-1999")
+	uidEntry.Validator = func(s string) error {
+		_, err := routemanager.ParseUIDRange(s)
+		return err
+	}
+
+	tableEntry := newTableEntry(rule.Table)
+
+	descEntry := widget.NewEntry()
+	descEntry.SetText(rule.Description)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Priority", priorityEntry),
+		widget.NewFormItem("From", fromEntry),
+		widget.NewFormItem("To", toEntry),
+		widget.NewFormItem("Firewall mark", fwMarkEntry),
+		widget.NewFormItem("Incoming interface", iifEntry),
+		widget.NewFormItem("Outgoing interface", oifEntry),
+		widget.NewFormItem("User IDs", uidEntry),
+		widget.NewFormItem("Lookup table", tableEntry),
+		widget.NewFormItem("Description", descEntry),
+	}
+	saveCheck := widget.NewCheck("Save to rules.json", nil)
+	saveCheck.SetChecked(true)
+	title, confirmText := "Edit Rule", "Save"
+	if isNew {
+		items = append(items, widget.NewFormItem("", saveCheck))
+		title, confirmText = "New Rule", "Add"
+	}
+
+	form := dialog.NewForm(title, confirmText, "Cancel", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		// Everything below has been checked by the validators.
+		edited := rule
+		edited.Priority = parseOptionalInt(priorityEntry.Text)
+		edited.From = strings.TrimSpace(fromEntry.Text)
+		edited.To = strings.TrimSpace(toEntry.Text)
+		edited.FwMark, edited.FwMask, _ = routemanager.ParseFwMark(fwMarkEntry.Text)
+		edited.Iif = strings.TrimSpace(iifEntry.Text)
+		edited.Oif = strings.TrimSpace(oifEntry.Text)
+		edited.UIDRange, _ = routemanager.ParseUIDRange(uidEntry.Text)
+		edited.Table, _ = routemanager.ParseTable(tableEntry.Text)
+		edited.Description = strings.TrimSpace(descEntry.Text)
+		onSave(edited, isNew && saveCheck.Checked)
+	}, parent)
+	form.Resize(fyne.NewSize(450, 0))
+	form.Show()
+}
+
+// newPrefixEntry creates an entry for an optional from/to prefix, empty meaning "all".
+func newPrefixEntry(prefix string) *widget.Entry {
+	entry := widget.NewEntry()
+	entry.SetText(prefix)
+	entry.SetPlaceHolder("all")
+	entry.Validator = validatorFor(func(s string) bool {
+		return s == "" || validators.ValidateCIDR(s)
+	}, "not a valid CIDR")
+	return entry
+}
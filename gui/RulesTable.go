@@ -0,0 +1,252 @@
+package gui
+
+import (
+	"image/color"
+	"log"
+	"route-manager/routemanager"
+	"slices"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ruleRow is a rule in the kernel, a saved rule, or both when they match.
+type ruleRow struct {
+	rule      routemanager.Rule // The saved rule if there is one, so it carries ID and description
+	live      *routemanager.SystemRule
+	saved     bool
+	protected bool
+}
+
+// RulesTable lists the policy routing rules in the kernel next to the saved ones.
+type RulesTable struct {
+	widget.BaseWidget
+	OnNew           func()
+	OnSourceRouting func()                                                      // Open the source routing wizard
+	OnEdit          func(rule routemanager.Rule, live *routemanager.SystemRule) // live is nil for a saved rule that isn't applied
+	OnApply         func(rule routemanager.Rule)                                // Add a saved rule to the kernel
+	OnRemove        func(rule routemanager.Rule)                                // Remove a rule from the kernel
+	OnSave          func(rule routemanager.Rule)                                // Save a live rule
+	OnDelete        func(rule routemanager.Rule)                                // Delete a saved rule from rules.json
+
+	table        *widget.Table
+	editButton   *widget.Button
+	applyButton  *widget.Button
+	removeButton *widget.Button
+	saveButton   *widget.Button
+	deleteButton *widget.Button
+	rows         []ruleRow
+	selected     int // Index into rows, -1 for none
+}
+
+var ruleColumns = []struct {
+	header string
+	width  float32
+	text   func(row ruleRow) string
+}{
+	{"Priority", 80, func(row ruleRow) string {
+		if row.live != nil {
+			return strconv.Itoa(row.live.Priority)
+		}
+		return optionalInt(row.rule.Priority)
+	}},
+	{"Selector", 320, func(row ruleRow) string {
+		if row.live != nil {
+			return row.live.Selector()
+		}
+		return row.rule.Selector()
+	}},
+	{"Action", 120, ruleActionText},
+	{"Status", 160, ruleStatusText},
+	{"Description", 250, func(row ruleRow) string { return row.rule.Description }},
+}
+
+func NewRulesTable() *RulesTable {
+	t := &RulesTable{selected: -1}
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+func (t *RulesTable) CreateRenderer() fyne.WidgetRenderer {
+	// 1. CREATE CONTROLS
+	newButton := widget.NewButtonWithIcon("New Rule", theme.ContentAddIcon(), func() {
+		if t.OnNew != nil {
+			t.OnNew()
+		}
+	})
+	wizardButton := widget.NewButtonWithIcon("Source Routing…", theme.SettingsIcon(), func() {
+		if t.OnSourceRouting != nil {
+			t.OnSourceRouting()
+		}
+	})
+	t.editButton = widget.NewButtonWithIcon("Edit", theme.DocumentCreateIcon(), func() {
+		if row, ok := t.selectedRow(); ok && t.OnEdit != nil {
+			t.OnEdit(row.rule, row.live)
+		}
+	})
+	t.applyButton = widget.NewButtonWithIcon("Apply", theme.MediaPlayIcon(), func() {
+		if row, ok := t.selectedRow(); ok && t.OnApply != nil {
+			t.OnApply(row.rule)
+		}
+	})
+	t.removeButton = widget.NewButtonWithIcon("Remove from System", theme.ContentRemoveIcon(), func() {
+		if row, ok := t.selectedRow(); ok && t.OnRemove != nil {
+			t.OnRemove(row.live.Rule)
+		}
+	})
+	t.saveButton = widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), func() {
+		if row, ok := t.selectedRow(); ok && t.OnSave != nil {
+			t.OnSave(row.live.Rule)
+		}
+	})
+	t.deleteButton = widget.NewButtonWithIcon("Delete from Saved", theme.DeleteIcon(), func() {
+		if row, ok := t.selectedRow(); ok && t.OnDelete != nil {
+			t.OnDelete(row.rule)
+		}
+	})
+
+	// 2. BUILD THE TABLE WITH AN INTEGRATED HEADER
+	t.table = &widget.Table{
+		Length: func() (int, int) {
+			return len(t.rows) + 1, len(ruleColumns)
+		},
+		CreateCell: func() fyne.CanvasObject {
+			return container.NewStack(
+				canvas.NewRectangle(color.Transparent),
+				widget.NewLabel(""),
+			)
+		},
+		UpdateCell: func(id widget.TableCellID, cell fyne.CanvasObject) {
+			stack := cell.(*fyne.Container)
+			bg := stack.Objects[0].(*canvas.Rectangle)
+			label := stack.Objects[1].(*widget.Label)
+
+			if id.Row == 0 {
+				label.SetText(ruleColumns[id.Col].header)
+				label.TextStyle.Bold = true
+				bg.FillColor = color.Transparent
+			} else {
+				label.TextStyle.Bold = false
+				label.SetText(ruleColumns[id.Col].text(t.rows[id.Row-1]))
+				if id.Row-1 == t.selected {
+					bg.FillColor = theme.FocusColor()
+				} else {
+					bg.FillColor = color.Transparent
+				}
+			}
+			bg.Refresh()
+			label.Refresh()
+		},
+		OnSelected: func(id widget.TableCellID) {
+			t.table.UnselectAll()
+			if id.Row == 0 {
+				return
+			}
+			if t.selected == id.Row-1 {
+				t.selected = -1
+			} else {
+				t.selected = id.Row - 1
+			}
+			t.updateButtons()
+			t.table.Refresh()
+		},
+	}
+	for i, col := range ruleColumns {
+		t.table.SetColumnWidth(i, col.width)
+	}
+
+	// 3. ASSEMBLE THE FINAL LAYOUT
+	controlBar := container.NewHBox(newButton, t.editButton, t.applyButton, t.removeButton, t.saveButton, t.deleteButton, wizardButton)
+	content := container.NewBorder(controlBar, nil, nil, nil, t.table)
+
+	t.Refresh()
+	return widget.NewSimpleRenderer(content)
+}
+
+// Refresh reloads the rules from the kernel and from rules.json.
+func (t *RulesTable) Refresh() {
+	if t.table == nil {
+		return // Not rendered yet, CreateRenderer will load the data.
+	}
+	live, err := routemanager.ListRules()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	saved, err := routemanager.LoadRules()
+	if err != nil {
+		log.Printf("ERROR: Failed to load saved rules: %v", err)
+	}
+
+	// Saved rules of other namespaces can't be told apart from unapplied ones here.
+	namespace := routemanager.CurrentNamespace()
+	saved = slices.DeleteFunc(saved, func(s routemanager.Rule) bool { return s.Namespace != namespace })
+
+	// Live rules come first, in the order the kernel tries them,
+	// followed by the saved rules that aren't applied right now.
+	t.rows = t.rows[:0]
+	matched := make([]bool, len(saved))
+	for i := range live {
+		row := ruleRow{rule: live[i].Rule, live: &live[i], protected: live[i].Protected()}
+		for j, s := range saved {
+			if !matched[j] && s.Matches(live[i]) {
+				row.rule, row.saved, matched[j] = s, true, true
+				break
+			}
+		}
+		t.rows = append(t.rows, row)
+	}
+	for j, s := range saved {
+		if !matched[j] {
+			t.rows = append(t.rows, ruleRow{rule: s, saved: true})
+		}
+	}
+
+	if t.selected >= len(t.rows) {
+		t.selected = -1
+	}
+	t.updateButtons()
+	t.table.Refresh()
+}
+
+func (t *RulesTable) selectedRow() (ruleRow, bool) {
+	if t.selected < 0 || t.selected >= len(t.rows) {
+		return ruleRow{}, false
+	}
+	return t.rows[t.selected], true
+}
+
+// updateButtons only offers what makes sense for the selected rule.
+// Protected rules can't be edited, removed or saved.
+func (t *RulesTable) updateButtons() {
+	row, ok := t.selectedRow()
+	setEnabled(t.editButton, ok && !row.protected)
+	setEnabled(t.applyButton, ok && row.live == nil)
+	setEnabled(t.removeButton, ok && row.live != nil && !row.protected)
+	setEnabled(t.saveButton, ok && row.live != nil && !row.saved && !row.protected)
+	setEnabled(t.deleteButton, ok && row.saved)
+}
+
+func ruleActionText(row ruleRow) string {
+	if row.live != nil && row.live.Action != "" {
+		return row.live.Action
+	}
+	return "lookup " + savedTableText(row.rule.Table)
+}
+
+func ruleStatusText(row ruleRow) string {
+	switch {
+	case row.protected && row.rule.IsDefault():
+		return "default (protected)"
+	case row.protected:
+		return "read-only"
+	case row.live != nil && row.saved:
+		return "active, saved"
+	case row.live != nil:
+		return "active"
+	}
+	return "saved, not applied"
+}
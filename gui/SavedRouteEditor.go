@@ -0,0 +1,205 @@
+package gui
+
+import (
+	"route-manager/routemanager"
+	"route-manager/validators"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ShowSavedRouteEditor opens a form for editing a saved route.
+// onSave receives the edited copy, with the ID and timestamps of the original.
+func ShowSavedRouteEditor(route routemanager.StaticRoute, parent fyne.Window, onSave func(routemanager.StaticRoute)) {
+	// A bound route shows the name its card has right now.
+	route = routemanager.ResolveBindings([]routemanager.StaticRoute{route})[0]
+
+	destEntry := widget.NewEntry()
+	destEntry.SetText(route.Destination)
+	destEntry.Validator = validatorFor(validators.ValidateCIDR, "not a valid CIDR")
+
+	gatewayEntry := widget.NewEntry()
+	gatewayEntry.SetText(route.Gateway)
+	gatewayEntry.SetPlaceHolder("none, device route")
+	gatewayEntry.Validator = validatorFor(validators.ValidateOptionalIP, "not a valid IP address")
+
+	onLinkCheck := widget.NewCheck("On-link (gateway outside the interface subnet)", nil)
+	onLinkCheck.SetChecked(route.OnLink)
+
+	metricEntry := widget.NewEntry()
+	metricEntry.SetText(optionalInt(route.Metric))
+	metricEntry.SetPlaceHolder("kernel default")
+	metricEntry.Validator = validatorFor(validators.ValidateOptionalUint, "must be a whole number")
+
+	// A SelectEntry also allows interfaces that are down right now.
+	aliases := routemanager.InterfaceAliases()
+	interfaceEntry := widget.NewSelectEntry(interfaceLabels(routemanager.GetInterfaceNames()))
+	interfaceEntry.SetText(interfaceLabel(route.Interface, aliases))
+
+	// Docks and USB dongles get different names on different machines,
+	// so the route can find its card by address or alias instead.
+	var bindLabels []string
+	for _, m := range bindModes {
+		bindLabels = append(bindLabels, m.label)
+	}
+	bindMode, _ := routemanager.ParseBinding(route.Bind)
+	bindSelect := widget.NewSelect(bindLabels, nil)
+	bindSelect.SetSelected(bindModeLabel(bindMode))
+
+	aliasEntry := widget.NewEntry()
+	aliasEntry.SetText(aliases[route.Interface])
+	aliasEntry.SetPlaceHolder("e.g. Office dock")
+
+	// VPN clients drop the routes on their tunnel when they disconnect. Routes on the
+	// tunnel, and bypass routes to the VPN server, come back when it is up again.
+	tunnelEntry := widget.NewSelectEntry(routemanager.TunnelInterfaces())
+	tunnelEntry.SetText(route.ReapplyOn)
+	tunnelEntry.SetPlaceHolder("never")
+
+	tableEntry := newTableEntry(route.Table)
+
+	namespaceEntry := widget.NewSelectEntry(routemanager.ListNamespaces())
+	namespaceEntry.SetText(route.Namespace)
+	namespaceEntry.SetPlaceHolder("host, or a name or pid:<pid>")
+
+	// Multipath routes list one next hop per line; a single path leaves this empty.
+	var hopLines []string
+	for _, hop := range route.NextHops {
+		hopLines = append(hopLines, hop.String())
+	}
+	nextHopsEntry := widget.NewMultiLineEntry()
+	nextHopsEntry.SetText(strings.Join(hopLines, "\n"))
+	nextHopsEntry.SetPlaceHolder("nexthop via 10.0.0.1 dev eth0 weight 2\nnexthop via 192.168.1.1 dev wlan0 weight 1")
+	nextHopsEntry.SetMinRowsVisible(3)
+	nextHopsEntry.Validator = func(text string) error {
+		_, err := routemanager.ParseNextHops(text)
+		return err
+	}
+
+	srcEntry := widget.NewEntry()
+	srcEntry.SetText(route.Src)
+	srcEntry.SetPlaceHolder("any")
+	srcEntry.Validator = validatorFor(validators.ValidateOptionalIP, "not a valid IP address")
+
+	mtuEntry := newOptionalUintEntry(route.MTU)
+	advMSSEntry := newOptionalUintEntry(route.AdvMSS)
+	cwndEntry := newOptionalUintEntry(route.InitCwnd)
+	rwndEntry := newOptionalUintEntry(route.InitRwnd)
+	congestionEntry := widget.NewSelectEntry(routemanager.GetCongestionControls())
+	congestionEntry.SetText(route.Congestion)
+	congestionEntry.SetPlaceHolder("system default")
+
+	descEntry := widget.NewEntry()
+	descEntry.SetText(route.Description)
+
+	tagsEntry := widget.NewEntry()
+	tagsEntry.SetText(strings.Join(route.Tags, ", "))
+
+	activeEntry := widget.NewEntry()
+	activeEntry.SetText(route.ActiveDuring)
+	activeEntry.SetPlaceHolder("always, or e.g. mon-fri 09:00-18:00")
+	activeEntry.Validator = func(text string) error {
+		_, err := routemanager.ParseWindows(text)
+		return err
+	}
+
+	enabledCheck := widget.NewCheck("Enabled", nil)
+	enabledCheck.SetChecked(route.Enabled())
+
+	typeSelect := newRouteTypeSelect(route.Type, gatewayEntry, onLinkCheck, interfaceEntry, bindSelect, aliasEntry, nextHopsEntry, srcEntry)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Destination", destEntry),
+		widget.NewFormItem("Type", typeSelect),
+		widget.NewFormItem("Gateway", gatewayEntry),
+		widget.NewFormItem("", onLinkCheck),
+		widget.NewFormItem("Interface", interfaceEntry),
+		widget.NewFormItem("Find interface by", bindSelect),
+		widget.NewFormItem("Interface alias", aliasEntry),
+		widget.NewFormItem("Metric", metricEntry),
+		widget.NewFormItem("Table / VRF", tableEntry),
+		widget.NewFormItem("Namespace", namespaceEntry),
+		widget.NewFormItem("Re-apply when tunnel is up", tunnelEntry),
+		widget.NewFormItem("Next hops", nextHopsEntry),
+		widget.NewFormItem("Source", srcEntry),
+		widget.NewFormItem("MTU", mtuEntry),
+		widget.NewFormItem("Advertised MSS", advMSSEntry),
+		widget.NewFormItem("Initial cwnd", cwndEntry),
+		widget.NewFormItem("Initial rwnd", rwndEntry),
+		widget.NewFormItem("Congestion control", congestionEntry),
+		widget.NewFormItem("Description", descEntry),
+		widget.NewFormItem("Tags", tagsEntry),
+		widget.NewFormItem("Active during", activeEntry),
+		widget.NewFormItem("", enabledCheck),
+	}
+
+	form := dialog.NewForm("Edit Saved Route", "Save", "Cancel", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		edited := route
+		edited.Destination = strings.TrimSpace(destEntry.Text)
+		edited.Gateway = strings.TrimSpace(gatewayEntry.Text)
+		edited.OnLink = onLinkCheck.Checked && edited.Gateway != ""
+		edited.Interface = interfaceFromLabel(interfaceEntry.Text)
+		edited.Metric = parseOptionalInt(metricEntry.Text)
+		edited.Table, _ = routemanager.ParseTable(tableEntry.Text) // Checked by the validator
+		edited.Namespace = strings.TrimSpace(namespaceEntry.Text)
+		edited.ReapplyOn = strings.TrimSpace(tunnelEntry.Text)
+		edited.NextHops, _ = routemanager.ParseNextHops(nextHopsEntry.Text) // Checked by the validator
+		if edited.IsMultipath() {
+			edited.Gateway, edited.Interface, edited.OnLink = "", "", false
+		}
+		edited.Src = strings.TrimSpace(srcEntry.Text)
+		edited.PathAttributes = routemanager.PathAttributes{
+			MTU:        parseOptionalInt(mtuEntry.Text),
+			AdvMSS:     parseOptionalInt(advMSSEntry.Text),
+			InitCwnd:   parseOptionalInt(cwndEntry.Text),
+			InitRwnd:   parseOptionalInt(rwndEntry.Text),
+			Congestion: strings.TrimSpace(congestionEntry.Text),
+		}
+		edited.Description = strings.TrimSpace(descEntry.Text)
+		edited.Tags = parseTags(tagsEntry.Text)
+		edited.ActiveDuring = strings.TrimSpace(activeEntry.Text)
+		edited.Disabled = !enabledCheck.Checked
+		setRouteType(&edited, typeSelect.Selected)
+		if err := bindInterface(&edited, route, bindModeFromLabel(bindSelect.Selected), aliasEntry.Text, aliases); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		onSave(edited)
+	}, parent)
+	form.Resize(fyne.NewSize(450, 0))
+	form.Show()
+}
+
+// bindInterface names the card of an edited route and binds the route to it the
+// chosen way. A binding that didn't change is kept, even while its card is away.
+func bindInterface(edited *routemanager.StaticRoute, original routemanager.StaticRoute,
+	mode routemanager.BindMode, alias string, aliases map[string]string) error {
+	if edited.Interface == "" || edited.IsMultipath() {
+		edited.Bind = ""
+		return nil
+	}
+
+	alias = strings.TrimSpace(alias)
+	aliasChanged := alias != aliases[edited.Interface]
+	if aliasChanged {
+		if err := routemanager.SetInterfaceAlias(edited.Interface, alias); err != nil {
+			return err
+		}
+	}
+
+	oldMode, _ := routemanager.ParseBinding(original.Bind)
+	if mode == oldMode && edited.Interface == original.Interface && !(aliasChanged && mode == routemanager.BindByAlias) {
+		return nil
+	}
+	bind, err := routemanager.BindingFor(edited.Interface, mode)
+	if err != nil {
+		return err
+	}
+	edited.Bind = bind
+	return nil
+}
@@ -0,0 +1,632 @@
+package gui
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"route-manager/routemanager"
+	"route-manager/validators"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// savedRow pairs a saved route with its current state in the kernel.
+type savedRow struct {
+	route   routemanager.StaticRoute
+	state   routemanager.RouteState
+	pending routemanager.PendingRoute // Set when state is StatePending
+	iface   string                    // Interface label, found through the route's binding
+	active  string                    // Activation windows, the route's own or its profiles'
+	next    string                    // When the scheduler turns the route on or off next
+}
+
+// SavedRoutesTable lists every saved route, the user's and the system-wide ones,
+// and offers bulk operations on them.
+type SavedRoutesTable struct {
+	widget.BaseWidget
+	OnApply  func(routes []routemanager.StaticRoute) // Add the routes to the kernel
+	OnRemove func(routes []routemanager.StaticRoute) // Remove the routes from the kernel, keep them saved
+	OnDelete func(routes []routemanager.StaticRoute) // Delete the routes from routes.json
+	OnEdit   func(route routemanager.StaticRoute)
+	// OnUpdate saves a route whose cell was edited inline.
+	OnUpdate func(route routemanager.StaticRoute)
+	// OnSchedules opens the activation windows of the profiles.
+	OnSchedules func()
+
+	table        *widget.Table
+	searchEntry  *widget.Entry
+	applyButton  *widget.Button
+	removeButton *widget.Button
+	deleteButton *widget.Button
+	editButton   *widget.Button
+	allRows      []savedRow
+	visibleRows  []savedRow
+	selected     map[string]bool // Keyed by saved route ID, survives filtering and sorting
+	sortColumn   int
+	sortAsc      bool
+	// The cell being edited inline: the route's ID and the column. Empty when none is.
+	editID    string
+	editCol   int
+	editStart bool // The entry still has to be filled in and focused
+}
+
+// savedColumn describes one column of the saved routes table.
+// Column 0 is the selection checkbox and has no text function.
+type savedColumn struct {
+	header  string
+	width   float32
+	text    func(row savedRow) string
+	compare func(a, b savedRow) int // nil sorts by text
+	edit    *cellEdit               // nil for columns that can't be edited inline
+}
+
+// cellEdit makes a column of the saved routes table editable inline.
+type cellEdit struct {
+	value func(route routemanager.StaticRoute) string // The text editing starts from
+	// apply sets the edited text on a route, or tells why it isn't valid.
+	apply func(route *routemanager.StaticRoute, text string) error
+	// allowed tells whether the cell of a route can be edited. nil allows every route.
+	allowed func(route routemanager.StaticRoute) bool
+}
+
+var savedColumns = []savedColumn{
+	{header: "", width: 40},
+	{header: "Status", width: 150, text: savedStatusText,
+		compare: func(a, b savedRow) int { return cmp.Compare(a.state, b.state) }},
+	{header: "Source", width: 80,
+		text: func(row savedRow) string { return savedSourceText(row.route.Source) }},
+	{header: "Destination", width: 180,
+		text:    func(row savedRow) string { return row.route.Destination },
+		compare: func(a, b savedRow) int { return compareAddresses(a.route.Destination, b.route.Destination) },
+		edit: &cellEdit{
+			value: func(r routemanager.StaticRoute) string { return r.Destination },
+			apply: func(r *routemanager.StaticRoute, text string) error {
+				if !validators.ValidateCIDR(text) {
+					return errors.New("not a valid CIDR")
+				}
+				r.Destination = strings.TrimSpace(text)
+				return nil
+			},
+		}},
+	{header: "Type", width: 90,
+		text: func(row savedRow) string { return routeTypeLabel(row.route.Type) }},
+	{header: "Gateway", width: 140,
+		text:    savedGatewayText,
+		compare: func(a, b savedRow) int { return compareAddresses(a.route.Gateway, b.route.Gateway) },
+		edit: &cellEdit{
+			value: func(r routemanager.StaticRoute) string { return r.Gateway },
+			apply: func(r *routemanager.StaticRoute, text string) error {
+				if !validators.ValidateOptionalIP(text) {
+					return errors.New("not a valid IP address")
+				}
+				r.Gateway = strings.TrimSpace(text)
+				r.OnLink = r.OnLink && r.Gateway != ""
+				return nil
+			},
+			// Multipath and special routes have no gateway of their own.
+			allowed: func(r routemanager.StaticRoute) bool {
+				return !r.IsMultipath() && !routemanager.IsSpecialType(r.Type)
+			},
+		}},
+	{header: "Interface", width: 140,
+		text: func(row savedRow) string { return row.iface }},
+	{header: "Bound By", width: 110,
+		text: savedBindText},
+	{header: "Metric", width: 70,
+		text:    func(row savedRow) string { return optionalInt(row.route.Metric) },
+		compare: func(a, b savedRow) int { return cmp.Compare(a.route.Metric, b.route.Metric) },
+		edit: &cellEdit{
+			value: func(r routemanager.StaticRoute) string { return optionalInt(r.Metric) },
+			apply: func(r *routemanager.StaticRoute, text string) error {
+				if !validators.ValidateOptionalUint(text) {
+					return errors.New("must be a whole number")
+				}
+				r.Metric = parseOptionalInt(text)
+				return nil
+			},
+		}},
+	{header: "Table", width: 90,
+		text:    func(row savedRow) string { return savedTableText(row.route.Table) },
+		compare: func(a, b savedRow) int { return cmp.Compare(a.route.Table, b.route.Table) }},
+	{header: "Namespace", width: 100,
+		text: func(row savedRow) string { return namespaceLabel(row.route.Namespace) }},
+	{header: "Re-apply On", width: 100,
+		text: func(row savedRow) string { return row.route.ReapplyOn }},
+	{header: "Active During", width: 160,
+		text: func(row savedRow) string { return row.active },
+		edit: &cellEdit{
+			value: func(r routemanager.StaticRoute) string { return r.ActiveDuring },
+			apply: func(r *routemanager.StaticRoute, text string) error {
+				if _, err := routemanager.ParseWindows(text); err != nil {
+					return err
+				}
+				r.ActiveDuring = strings.TrimSpace(text)
+				return nil
+			},
+		}},
+	{header: "Next Change", width: 130,
+		text: func(row savedRow) string { return row.next }},
+	{header: "Description", width: 250,
+		text: func(row savedRow) string { return row.route.Description },
+		edit: &cellEdit{
+			value: func(r routemanager.StaticRoute) string { return r.Description },
+			apply: func(r *routemanager.StaticRoute, text string) error {
+				r.Description = strings.TrimSpace(text)
+				return nil
+			},
+		}},
+	{header: "Tags", width: 150,
+		text: func(row savedRow) string { return strings.Join(row.route.Tags, ", ") },
+		edit: &cellEdit{
+			value: func(r routemanager.StaticRoute) string { return strings.Join(r.Tags, ", ") },
+			apply: func(r *routemanager.StaticRoute, text string) error {
+				r.Tags = parseTags(text)
+				return nil
+			},
+		}},
+	{header: "Last Applied", width: 150, text: savedLastAppliedText,
+		compare: func(a, b savedRow) int { return a.route.LastAppliedAt.Compare(b.route.LastAppliedAt) }},
+}
+
+func NewSavedRoutesTable() *SavedRoutesTable {
+	t := &SavedRoutesTable{selected: map[string]bool{}, sortColumn: 3, sortAsc: true}
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+func (t *SavedRoutesTable) CreateRenderer() fyne.WidgetRenderer {
+	// 1. CREATE CONTROLS
+	t.searchEntry = widget.NewEntry()
+	t.searchEntry.SetPlaceHolder("Search destination, gateway, interface, description or tag")
+	t.searchEntry.OnChanged = func(string) { t.applyFilter() }
+
+	t.applyButton = widget.NewButtonWithIcon("Apply", theme.MediaPlayIcon(), func() {
+		if t.OnApply != nil {
+			t.OnApply(t.SelectedRoutes())
+		}
+	})
+	t.removeButton = widget.NewButtonWithIcon("Remove from System", theme.ContentRemoveIcon(), func() {
+		if t.OnRemove != nil {
+			t.OnRemove(t.SelectedRoutes())
+		}
+	})
+	t.deleteButton = widget.NewButtonWithIcon("Delete from Saved", theme.DeleteIcon(), func() {
+		if t.OnDelete != nil {
+			t.OnDelete(t.SelectedRoutes())
+		}
+	})
+	t.editButton = widget.NewButtonWithIcon("Edit", theme.DocumentCreateIcon(), func() {
+		selected := t.SelectedRoutes()
+		if len(selected) == 1 && t.OnEdit != nil {
+			t.OnEdit(selected[0])
+		}
+	})
+	schedulesButton := widget.NewButtonWithIcon("Schedules…", theme.HistoryIcon(), func() {
+		if t.OnSchedules != nil {
+			t.OnSchedules()
+		}
+	})
+
+	// 2. BUILD THE TABLE WITH AN INTEGRATED HEADER
+	t.table = &widget.Table{
+		Length: func() (int, int) {
+			return len(t.visibleRows) + 1, len(savedColumns)
+		},
+		CreateCell: func() fyne.CanvasObject {
+			entry := newCellEntry()
+			entry.Hide()
+			return container.NewStack(
+				canvas.NewRectangle(color.Transparent),
+				widget.NewLabel(""),
+				entry,
+			)
+		},
+		UpdateCell: func(id widget.TableCellID, cell fyne.CanvasObject) {
+			stack := cell.(*fyne.Container)
+			bg := stack.Objects[0].(*canvas.Rectangle)
+			label := stack.Objects[1].(*widget.Label)
+			entry := stack.Objects[2].(*cellEntry)
+
+			if id.Row > 0 && t.isEditing(t.visibleRows[id.Row-1], id.Col) {
+				t.updateEditor(entry, t.visibleRows[id.Row-1].route, id.Col)
+				label.Hide()
+				entry.Show()
+				return
+			}
+			entry.onCancel, entry.OnSubmitted = nil, nil
+			entry.Hide()
+			label.Show()
+
+			if id.Row == 0 { // HEADER row, clicking it sorts by that column
+				label.SetText(t.headerText(id.Col))
+				label.TextStyle.Bold = true
+				bg.FillColor = color.Transparent
+			} else {
+				row := t.visibleRows[id.Row-1]
+				label.TextStyle.Bold = false
+				label.SetText(savedCellText(row, id.Col, t.selected[row.route.ID]))
+				if t.selected[row.route.ID] {
+					bg.FillColor = theme.FocusColor()
+				} else {
+					bg.FillColor = color.Transparent
+				}
+			}
+			bg.Refresh()
+			label.Refresh()
+		},
+		OnSelected: func(id widget.TableCellID) {
+			// The table is only used as a click target; our own selection lives in t.selected.
+			t.table.UnselectAll()
+			if id.Row == 0 {
+				t.headerTapped(id.Col)
+				return
+			}
+			row := t.visibleRows[id.Row-1]
+			if t.canEdit(row, id.Col) {
+				t.editID, t.editCol, t.editStart = row.route.ID, id.Col, true
+				t.table.Refresh()
+				return
+			}
+			routeID := row.route.ID
+			if t.selected[routeID] {
+				delete(t.selected, routeID)
+			} else {
+				t.selected[routeID] = true
+			}
+			t.updateButtons()
+			t.table.Refresh()
+		},
+	}
+	for i, col := range savedColumns {
+		t.table.SetColumnWidth(i, col.width)
+	}
+
+	// 3. ASSEMBLE THE FINAL LAYOUT
+	buttons := container.NewHBox(t.applyButton, t.removeButton, t.deleteButton, t.editButton, schedulesButton, newPendingExpirySelect())
+	controlBar := container.NewBorder(nil, nil, nil, buttons, t.searchEntry)
+	content := container.NewBorder(controlBar, nil, nil, nil, t.table)
+
+	t.Refresh()
+	return widget.NewSimpleRenderer(content)
+}
+
+// Refresh reloads the saved routes and compares them against the kernel.
+func (t *SavedRoutesTable) Refresh() {
+	if t.table == nil {
+		return // Not rendered yet, CreateRenderer will load the data.
+	}
+	routes, err := routemanager.LoadRoutes()
+	if err != nil {
+		log.Printf("ERROR: Failed to load routes: %v", err)
+		return
+	}
+	// Saved routes may target different namespaces, each is listed once.
+	live := map[string][]routemanager.SystemRoute{}
+	// Bound routes are compared by the name their interface has right now.
+	resolved := routemanager.ResolveBindings(routes)
+	aliases := routemanager.InterfaceAliases()
+	profiles, err := routemanager.LoadProfiles()
+	if err != nil {
+		log.Printf("ERROR: Failed to load profiles: %v", err)
+	}
+	now := time.Now()
+
+	t.allRows = t.allRows[:0]
+	known := map[string]bool{}
+	for i, r := range routes {
+		if _, ok := live[r.Namespace]; !ok {
+			live[r.Namespace] = routemanager.ListSystemRoutesIn(r.Namespace)
+		}
+		row := savedRow{
+			route: r,
+			state: routemanager.SavedRouteState(resolved[i], live[r.Namespace]),
+			iface: savedInterfaceText(resolved[i], aliases),
+		}
+		if row.state == routemanager.StatePending {
+			row.pending, _ = routemanager.PendingFor(r)
+		}
+		row.active, row.next = savedScheduleText(r, profiles, now)
+		t.allRows = append(t.allRows, row)
+		known[r.ID] = true
+	}
+	// Forget selections of routes that were deleted in the meantime.
+	for id := range t.selected {
+		if !known[id] {
+			delete(t.selected, id)
+		}
+	}
+	t.applyFilter()
+}
+
+// SelectedRoutes returns the selected saved routes in display order.
+func (t *SavedRoutesTable) SelectedRoutes() []routemanager.StaticRoute {
+	var routes []routemanager.StaticRoute
+	for _, row := range t.allRows {
+		if t.selected[row.route.ID] {
+			routes = append(routes, row.route)
+		}
+	}
+	return routes
+}
+
+func (t *SavedRoutesTable) applyFilter() {
+	query := strings.ToLower(strings.TrimSpace(t.searchEntry.Text))
+
+	t.visibleRows = t.visibleRows[:0]
+	for _, row := range t.allRows {
+		if query == "" || savedRowMatches(row, query) {
+			t.visibleRows = append(t.visibleRows, row)
+		}
+	}
+
+	col, asc := t.sortColumn, t.sortAsc
+	sort.SliceStable(t.visibleRows, func(i, j int) bool {
+		c := compareSavedRows(t.visibleRows[i], t.visibleRows[j], col)
+		if asc {
+			return c < 0
+		}
+		return c > 0
+	})
+
+	t.updateButtons()
+	t.table.Refresh()
+}
+
+func (t *SavedRoutesTable) headerTapped(col int) {
+	if col == 0 {
+		// The selection column header toggles all visible rows.
+		allSelected := len(t.visibleRows) > 0
+		for _, row := range t.visibleRows {
+			allSelected = allSelected && t.selected[row.route.ID]
+		}
+		for _, row := range t.visibleRows {
+			if allSelected {
+				delete(t.selected, row.route.ID)
+			} else {
+				t.selected[row.route.ID] = true
+			}
+		}
+		t.updateButtons()
+		t.table.Refresh()
+		return
+	}
+	if t.sortColumn == col {
+		t.sortAsc = !t.sortAsc
+	} else {
+		t.sortColumn, t.sortAsc = col, true
+	}
+	t.applyFilter()
+}
+
+func (t *SavedRoutesTable) headerText(col int) string {
+	if col == 0 {
+		return "☐"
+	}
+	return sortedHeaderText(savedColumns[col].header, col == t.sortColumn, t.sortAsc)
+}
+
+// canEdit tells whether clicking a cell edits it inline instead of selecting its row.
+func (t *SavedRoutesTable) canEdit(row savedRow, col int) bool {
+	edit := savedColumns[col].edit
+	return edit != nil && (edit.allowed == nil || edit.allowed(row.route))
+}
+
+func (t *SavedRoutesTable) isEditing(row savedRow, col int) bool {
+	return t.editID != "" && row.route.ID == t.editID && col == t.editCol
+}
+
+// updateEditor shows the entry of the cell being edited. Enter saves the route,
+// unless the text isn't valid for the column.
+func (t *SavedRoutesTable) updateEditor(entry *cellEntry, route routemanager.StaticRoute, col int) {
+	edit := savedColumns[col].edit
+	entry.Validator = func(text string) error {
+		edited := route
+		return edit.apply(&edited, text)
+	}
+	entry.OnSubmitted = func(text string) {
+		edited := route
+		if edit.apply(&edited, text) != nil {
+			return // The entry already shows why
+		}
+		t.stopEditing()
+		if t.OnUpdate != nil {
+			t.OnUpdate(edited)
+		}
+	}
+	entry.onCancel = t.stopEditing
+	if t.editStart {
+		t.editStart = false
+		entry.SetText(edit.value(route))
+		if c := fyne.CurrentApp().Driver().CanvasForObject(t.table); c != nil {
+			c.Focus(entry)
+		}
+	}
+}
+
+// stopEditing closes the inline editor without saving anything.
+func (t *SavedRoutesTable) stopEditing() {
+	if t.editID == "" {
+		return
+	}
+	t.editID = ""
+	if c := fyne.CurrentApp().Driver().CanvasForObject(t.table); c != nil {
+		c.Unfocus()
+	}
+	t.table.Refresh()
+}
+
+func (t *SavedRoutesTable) updateButtons() {
+	count := len(t.SelectedRoutes())
+	setEnabled(t.applyButton, count > 0)
+	setEnabled(t.removeButton, count > 0)
+	setEnabled(t.deleteButton, count > 0)
+	setEnabled(t.editButton, count == 1)
+}
+
+func savedCellText(row savedRow, col int, selected bool) string {
+	if col == 0 {
+		if selected {
+			return "☑"
+		}
+		return "☐"
+	}
+	return savedColumns[col].text(row)
+}
+
+func savedStatusText(row savedRow) string {
+	text := row.state.String()
+	if row.state == routemanager.StatePending && !row.pending.ExpiresAt.IsZero() {
+		text += " until " + row.pending.ExpiresAt.Local().Format("Jan 2 15:04")
+	}
+	if !row.route.Enabled() {
+		text += " (disabled)"
+	}
+	return text
+}
+
+func savedLastAppliedText(row savedRow) string {
+	if row.route.LastAppliedAt.IsZero() {
+		return "never"
+	}
+	return row.route.LastAppliedAt.Local().Format("2006-01-02 15:04")
+}
+
+// savedTableText names the table of a saved route, where 0 stands for main.
+func savedTableText(table int) string {
+	if table == 0 {
+		table = routemanager.MainTable
+	}
+	return routemanager.TableName(table)
+}
+
+func savedGatewayText(row savedRow) string {
+	if row.route.IsMultipath() {
+		return fmt.Sprintf("%d next hops", len(row.route.NextHops))
+	}
+	return row.route.Gateway
+}
+
+func savedInterfaceText(route routemanager.StaticRoute, aliases map[string]string) string {
+	if !route.IsMultipath() {
+		return interfaceLabel(route.Interface, aliases)
+	}
+	var names []string
+	for _, hop := range route.NextHops {
+		if !slices.Contains(names, hop.Interface) {
+			names = append(names, hop.Interface)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// savedScheduleText describes when a route is active and when that changes next.
+func savedScheduleText(route routemanager.StaticRoute, profiles []routemanager.Profile, now time.Time) (active, next string) {
+	windows, err := routemanager.RouteWindows(route, profiles)
+	if err != nil {
+		return "invalid", ""
+	}
+	if len(windows) == 0 {
+		return "", ""
+	}
+	active = route.ActiveDuring
+	if active == "" {
+		var names []string
+		for _, p := range profiles {
+			if p.ActiveDuring != "" && slices.Contains(route.Tags, p.Name) {
+				names = append(names, p.Name)
+			}
+		}
+		active = "profile " + strings.Join(names, ", ")
+	}
+	if at, ok := routemanager.NextTransition(windows, now); ok {
+		next = transitionText(!routemanager.ActiveAt(windows, now), at, now)
+	}
+	return active, next
+}
+
+// transitionText says what happens when, e.g. "on Mon 09:00".
+func transitionText(activate bool, at, now time.Time) string {
+	text := "off "
+	if activate {
+		text = "on "
+	}
+	at = at.Local()
+	if y, m, d := at.Date(); y == now.Year() && m == now.Month() && d == now.Day() {
+		return text + at.Format("15:04")
+	}
+	return text + at.Format("Mon Jan 2 15:04")
+}
+
+// savedSourceText names the store a route is saved in.
+func savedSourceText(source routemanager.StoreSource) string {
+	if source == routemanager.SourceSystem {
+		return "System"
+	}
+	return "User"
+}
+
+// savedBindText shows how a route finds its interface, empty when it goes by name.
+func savedBindText(row savedRow) string {
+	mode, value := routemanager.ParseBinding(row.route.Bind)
+	if mode == routemanager.BindByName {
+		return ""
+	}
+	if mode == routemanager.BindByAlias {
+		return "alias " + value
+	}
+	return bindModeLabel(mode)
+}
+
+func compareSavedRows(a, b savedRow, col int) int {
+	if compare := savedColumns[col].compare; compare != nil {
+		return compare(a, b)
+	}
+	return strings.Compare(savedCellText(a, col, false), savedCellText(b, col, false))
+}
+
+func savedRowMatches(row savedRow, query string) bool {
+	for col := 1; col < len(savedColumns); col++ {
+		if strings.Contains(strings.ToLower(savedCellText(row, col, false)), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// cellEntry edits a cell of a table inline. Escape, or clicking somewhere else,
+// leaves the cell without saving.
+type cellEntry struct {
+	widget.Entry
+	onCancel func()
+}
+
+func newCellEntry() *cellEntry {
+	e := &cellEntry{}
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+func (e *cellEntry) TypedKey(key *fyne.KeyEvent) {
+	if key.Name == fyne.KeyEscape && e.onCancel != nil {
+		e.onCancel()
+		return
+	}
+	e.Entry.TypedKey(key)
+}
+
+func (e *cellEntry) FocusLost() {
+	e.Entry.FocusLost()
+	if e.onCancel != nil {
+		e.onCancel()
+	}
+}
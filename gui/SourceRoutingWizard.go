@@ -0,0 +1,107 @@
+package gui
+
+import (
+	"fmt"
+	"route-manager/routemanager"
+	"route-manager/validators"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ShowSourceRoutingWizard lets the user pick the interfaces that should answer
+// on the interface a connection came in on. Each picked interface gets its own
+// table and rule. Interfaces that are already set up start out ticked, and
+// unticking one removes its setup. It works on the namespace that is shown;
+// onConfirm receives that namespace and the setups to keep there.
+func ShowSourceRoutingWizard(parent fyne.Window, onConfirm func(namespace string, setups []routemanager.SourceRoute)) {
+	namespace := routemanager.CurrentNamespace()
+	suggestions, err := routemanager.SuggestSourceRoutes(namespace, routemanager.GetInterfaceNames())
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+	saved, err := routemanager.LoadSourceRoutes()
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+	saved = slices.DeleteFunc(saved, func(s routemanager.SourceRoute) bool { return s.Namespace != namespace })
+
+	aliases := routemanager.InterfaceAliases()
+
+	// 1. ONE ROW PER INTERFACE: PICK IT, CHECK ITS GATEWAY AND TABLE
+	intro := widget.NewLabel("Replies leave through the interface the request came in on. " +
+		"Each ticked interface gets a table with its own default route, and a rule " +
+		"for traffic from its address. The rule follows the address when DHCP changes it.")
+	intro.Wrapping = fyne.TextWrapWord
+
+	grid := container.NewGridWithColumns(3,
+		widget.NewLabelWithStyle("Interface", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Gateway", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabelWithStyle("Table", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+	)
+	checks := make([]*widget.Check, len(suggestions))
+	gatewayEntries := make([]*widget.Entry, len(suggestions))
+	tableEntries := make([]*widget.Entry, len(suggestions))
+	for i, s := range suggestions {
+		label := interfaceLabel(s.Interface, aliases)
+		if s.Address != "" {
+			label = fmt.Sprintf("%s, %s", label, s.Address)
+		}
+		checks[i] = widget.NewCheck(label, nil)
+		checks[i].SetChecked(s.ID != "")
+
+		gatewayEntries[i] = widget.NewEntry()
+		gatewayEntries[i].SetText(s.Gateway)
+		gatewayEntries[i].SetPlaceHolder("e.g. 192.168.1.1")
+		gatewayEntries[i].Validator = validatorFor(validators.ValidateIP, "not a valid IP address")
+
+		tableEntries[i] = widget.NewEntry()
+		tableEntries[i].SetText(strconv.Itoa(s.Table))
+		// The setup needs a table of its own, never main (254) or the local table.
+		tableEntries[i].Validator = validatorFor(func(s string) bool {
+			n, err := strconv.Atoi(s)
+			return err == nil && n > 0 && n != routemanager.MainTable && !routemanager.IsHiddenTable(n)
+		}, "must be a free table number")
+
+		grid.Add(checks[i])
+		grid.Add(gatewayEntries[i])
+		grid.Add(tableEntries[i])
+	}
+
+	// 2. COLLECT THE TICKED INTERFACES ON CONFIRM
+	content := container.NewVBox(intro, grid)
+	wizard := dialog.NewCustomConfirm("Source Routing", "Apply", "Cancel", content, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		var setups []routemanager.SourceRoute
+		for i, s := range suggestions {
+			if !checks[i].Checked {
+				continue
+			}
+			if gatewayEntries[i].Validate() != nil || tableEntries[i].Validate() != nil {
+				dialog.ShowError(fmt.Errorf("%s needs a valid gateway and table", s.Interface), parent)
+				return
+			}
+			s.Gateway = strings.TrimSpace(gatewayEntries[i].Text)
+			s.Table = parseOptionalInt(tableEntries[i].Text)
+			setups = append(setups, s)
+		}
+		// Interfaces that are set up but down right now aren't listed; keep them.
+		for _, s := range saved {
+			if !slices.ContainsFunc(suggestions, func(x routemanager.SourceRoute) bool { return x.Interface == s.Interface }) {
+				setups = append(setups, s)
+			}
+		}
+		onConfirm(namespace, setups)
+	}, parent)
+	wizard.Resize(fyne.NewSize(600, 0))
+	wizard.Show()
+}
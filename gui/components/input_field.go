@@ -72,22 +72,26 @@ func NewInputField(placeholder string, validator ValidatorFunc) *InputField {
 	field.entry.SetPlaceHolder(placeholder)
 	field.border = canvas.NewRectangle(color.Transparent)
 	field.border.CornerRadius = 5
-	field.entry.OnChanged = func(text string) {
-		isValid := field.validator(text)
-		if text == "" {
-			field.border.FillColor = color.Transparent
-		} else if isValid {
-			field.border.FillColor = color.NRGBA{R: 0, G: 255, B: 0, A: 40}
-		} else {
-			field.border.FillColor = color.NRGBA{R: 255, G: 0, B: 0, A: 40}
-		}
-		field.border.Refresh()
-		if field.OnValidationChanged != nil {
-			field.OnValidationChanged(isValid)
-		}
-	}
+	field.entry.OnChanged = field.validate
 	return field
 }
+
+// validate colors the border and reports whether text passes the validator.
+func (f *InputField) validate(text string) {
+	isValid := f.validator(text)
+	if text == "" {
+		f.border.FillColor = color.Transparent
+	} else if isValid {
+		f.border.FillColor = color.NRGBA{R: 0, G: 255, B: 0, A: 40}
+	} else {
+		f.border.FillColor = color.NRGBA{R: 255, G: 0, B: 0, A: 40}
+	}
+	f.border.Refresh()
+	if f.OnValidationChanged != nil {
+		f.OnValidationChanged(isValid)
+	}
+}
+
 func (f *InputField) SetMinWidth(width float32) {
 	f.minWidth = width
 }
@@ -97,3 +101,18 @@ func (f *InputField) Text() string {
 func (f *InputField) SetText(text string) {
 	f.entry.SetText(text)
 }
+
+// Enable allows typing into the field.
+func (f *InputField) Enable() {
+	f.entry.Enable()
+}
+
+// Disable greys the field out and stops it from taking input.
+func (f *InputField) Disable() {
+	f.entry.Disable()
+}
+
+// Revalidate runs the validator again, for validators that depend on other fields.
+func (f *InputField) Revalidate() {
+	f.validate(f.entry.Text)
+}
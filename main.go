@@ -1,18 +1,39 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"os"
 	"route-manager/gui"
 	"route-manager/routemanager"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
 )
 
+// probeTimeout is how long the network may take to answer after the default gateway changed.
+const probeTimeout = 5 * time.Second
+
 func main() {
-	myApp := app.New()
+	store := flag.String("store", "", "directory of the saved routes, e.g. "+routemanager.SystemStoreDir+
+		" for system-wide ones (default $"+routemanager.StoreEnv+" or ~/.config/route-manager)")
+	flag.Parse()
+	if *store != "" {
+		routemanager.SetStoreDir(*store)
+	}
+	if isCommand(flag.Args()) {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	// The unique ID lets Fyne persist preferences such as the route table filter.
+	myApp := app.NewWithID("io.github.olmosjt.route-manager")
 	myWindow := myApp.NewWindow("Route Manager")
 
 	// 1. Create the UI components
@@ -20,35 +41,68 @@ func main() {
 	quickApply := gui.NewQuickApplyBar()
 	helpSection := gui.NewHelpSection()
 	routeTable := gui.NewRouteTable() // Create the route table
+	savedTable := gui.NewSavedRoutesTable()
+	rulesTable := gui.NewRulesTable()
+	namespaceSelector := gui.NewNamespaceSelector()
 
 	// 2. Define the application's core logic
 
 	// Logic for adding a NEW route
-	header.OnAdd = func(route routemanager.StaticRoute, save bool) {
-		if err := routemanager.Add(route); err != nil {
+	header.OnAdd = func(route routemanager.StaticRoute, save bool, lifetime time.Duration) {
+		var queued bool
+		var err error
+		if lifetime > 0 {
+			// A route for a debugging session has no use once its interface shows up later.
+			err = routemanager.AddTemporary(route, lifetime)
+		} else {
+			queued, err = routemanager.AddOrQueue(route, gui.PendingExpiry())
+		}
+		if err != nil {
 			dialog.ShowError(err, myWindow)
 			return
 		}
 		if save {
+			if !queued {
+				route.LastAppliedAt = time.Now()
+			}
 			if err := routemanager.AppendRoute(route); err != nil {
 				dialog.ShowError(err, myWindow)
 			}
 		}
-		dialog.ShowInformation("Success", "Successfully applied route", myWindow)
+		switch {
+		case queued:
+			showPending(route, myWindow)
+		case lifetime > 0:
+			msg := fmt.Sprintf("Successfully applied route. It is removed again at %s.", time.Now().Add(lifetime).Format("15:04"))
+			dialog.ShowInformation("Success", msg, myWindow)
+		default:
+			dialog.ShowInformation("Success", "Successfully applied route", myWindow)
+		}
 		header.ClearFields()
 		// Refresh other components
 		quickApply.Refresh()
 		routeTable.Refresh()
+		savedTable.Refresh()
 	}
 
 	// Logic for applying an EXISTING saved route
 	quickApply.OnApply = func(route routemanager.StaticRoute) {
-		if err := routemanager.Add(route); err != nil {
+		queued, err := routemanager.AddOrQueue(route, gui.PendingExpiry())
+		if err != nil {
 			dialog.ShowError(err, myWindow)
 			return
 		}
+		if queued {
+			showPending(route, myWindow)
+			savedTable.Refresh()
+			return
+		}
+		if err := routemanager.MarkApplied(route); err != nil {
+			log.Printf("WARN: Could not record when the route was applied: %v", err)
+		}
 		dialog.ShowInformation("Success", "Successfully re-applied route", myWindow)
 		routeTable.Refresh() // Refresh the table to show the new active route
+		savedTable.Refresh()
 	}
 
 	quickApply.OnDelete = func(route routemanager.StaticRoute) {
@@ -57,13 +111,14 @@ func main() {
 				return
 			}
 			// User confirmed, now call the backend function to delete from JSON
-			if err := routemanager.DeleteRoute(route); err != nil {
+			if err := routemanager.DeleteRoute(route.ID); err != nil {
 				dialog.ShowError(err, myWindow)
 				return
 			}
 			dialog.ShowInformation("Success", "Route removed from saved history.", myWindow)
 			// Refresh the bar to show the updated list
 			quickApply.Refresh()
+			savedTable.Refresh()
 		}
 		// Ask for confirmation before permanently deleting
 		confirmMsg := fmt.Sprintf("Permanently delete this route from your saved history?\n\n%s", route.Destination)
@@ -71,43 +126,384 @@ func main() {
 	}
 
 	// Logic for DELETING a route from the table
-	routeTable.OnDelete = func(route routemanager.StaticRoute) {
-		// Ask for confirmation before deleting
+	routeTable.OnDelete = func(routes []routemanager.StaticRoute) {
+		// Ask for confirmation once, listing every route that is about to go
 		confirmCallback := func(confirm bool) {
 			if !confirm {
 				return
 			}
 			// User confirmed, proceed with deletion
-			if err := routemanager.Delete(route); err != nil {
+			err := routemanager.DeleteAll(routes)
+			showBulkResult("Deleted", len(routes), err, myWindow)
+
+			// Refresh components to reflect the change
+			quickApply.Refresh()
+			routeTable.Refresh()
+			savedTable.Refresh()
+		}
+		confirmMsg := fmt.Sprintf("Are you sure you want to delete these routes?\n\n%s", routeList(routes))
+		dialog.ShowConfirm("Confirm Deletion", confirmMsg, confirmCallback, myWindow)
+	}
+
+	routeTable.OnSave = func(routes []routemanager.StaticRoute) {
+		if err := routemanager.AppendRoutes(routes); err != nil {
+			dialog.ShowError(err, myWindow)
+			return
+		}
+		dialog.ShowInformation("Success", fmt.Sprintf("Saved %d route(s) to your saved history.", len(routes)), myWindow)
+		quickApply.Refresh()
+		routeTable.Refresh()
+		savedTable.Refresh()
+	}
+
+	// Logic for EDITING a live route. The change is applied in place and, if the
+	// route was saved, the saved entry follows along.
+	routeTable.OnEdit = func(old routemanager.StaticRoute) {
+		gui.ShowLiveRouteEditor(old, myWindow, func(edited routemanager.StaticRoute) {
+			if err := routemanager.Replace(old, edited); err != nil {
 				dialog.ShowError(err, myWindow)
+				routeTable.Refresh()
 				return
 			}
+			updated, err := routemanager.UpdateMatchingRoute(old, edited)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("route was changed, but the saved copy could not be updated: %w", err), myWindow)
+			} else if updated {
+				dialog.ShowInformation("Success", "Route changed and saved copy updated.", myWindow)
+			} else {
+				dialog.ShowInformation("Success", "Route changed.", myWindow)
+			}
+			quickApply.Refresh()
+			routeTable.Refresh()
+			savedTable.Refresh()
+		})
+	}
 
-			successMsg := fmt.Sprintf("Successfully deleted route to %s", route.Destination)
-			dialog.ShowInformation("Success", successMsg, myWindow)
+	// Logic for SWITCHING the default gateway. Losing the default route cuts the host
+	// off, so the change is confirmed first and undone if the probe target can't be reached.
+	routeTable.OnSwitchDefault = func() {
+		gui.ShowDefaultGatewaySwitcher(myWindow, func(choice gui.DefaultGatewayChoice) {
+			confirmMsg := fmt.Sprintf("Make %s on %s the default gateway?\n\n"+
+				"If %s can't be reached within %s afterwards, the previous default route is restored.",
+				choice.Gateway, choice.Interface, choice.ProbeTarget, probeTimeout)
+			dialog.ShowConfirm("Confirm Default Gateway", confirmMsg, func(confirm bool) {
+				if !confirm {
+					return
+				}
+				progress := dialog.NewCustomWithoutButtons("Switching default gateway…", widget.NewProgressBarInfinite(), myWindow)
+				progress.Show()
+				// The probe blocks for up to probeTimeout, so keep it off the UI thread.
+				go func() {
+					err := routemanager.SwitchDefaultGateway(choice.Namespace, choice.Gateway, choice.Interface, choice.Mode, choice.ProbeTarget, probeTimeout)
+					fyne.Do(func() {
+						progress.Hide()
+						if err != nil {
+							dialog.ShowError(err, myWindow)
+						} else {
+							dialog.ShowInformation("Success", "Default gateway switched and the network is reachable.", myWindow)
+						}
+						routeTable.Refresh()
+					})
+				}()
+			}, myWindow)
+		})
+	}
 
-			// Refresh components to reflect the change
+	// Logic for the saved routes manager. Every action works on the whole selection
+	// and reports the routes that failed instead of stopping at the first error.
+	savedTable.OnApply = func(routes []routemanager.StaticRoute) {
+		// Routes whose interface is missing wait for it and count as applied here;
+		// the table shows them as pending.
+		err := routemanager.Batch(routes, func(route routemanager.StaticRoute) error {
+			queued, err := routemanager.AddOrQueue(route, gui.PendingExpiry())
+			if err != nil || queued {
+				return err
+			}
+			return routemanager.MarkApplied(route)
+		})
+		showBulkResult("Applied", len(routes), err, myWindow)
+		routeTable.Refresh()
+		savedTable.Refresh()
+	}
+
+	savedTable.OnRemove = func(routes []routemanager.StaticRoute) {
+		confirmMsg := fmt.Sprintf("Remove these routes from the system? They stay saved.\n\n%s", routeList(routes))
+		dialog.ShowConfirm("Confirm Removal", confirmMsg, func(confirm bool) {
+			if !confirm {
+				return
+			}
+			// A pending route isn't in the kernel yet, it only stops waiting.
+			var live []routemanager.StaticRoute
+			for _, route := range routes {
+				if !routemanager.CancelPending(route) {
+					live = append(live, route)
+				}
+			}
+			err := routemanager.DeleteAll(live)
+			showBulkResult("Removed", len(routes), err, myWindow)
+			routeTable.Refresh()
+			savedTable.Refresh()
+		}, myWindow)
+	}
+
+	savedTable.OnDelete = func(routes []routemanager.StaticRoute) {
+		confirmMsg := fmt.Sprintf("Permanently delete these routes from your saved history?\n\n%s", routeList(routes))
+		dialog.ShowConfirm("Confirm History Deletion", confirmMsg, func(confirm bool) {
+			if !confirm {
+				return
+			}
+			err := routemanager.Batch(routes, func(route routemanager.StaticRoute) error {
+				routemanager.CancelPending(route)
+				return routemanager.DeleteRoute(route.ID)
+			})
+			showBulkResult("Deleted", len(routes), err, myWindow)
 			quickApply.Refresh()
 			routeTable.Refresh()
+			savedTable.Refresh()
+		}, myWindow)
+	}
+
+	savedTable.OnEdit = func(route routemanager.StaticRoute) {
+		gui.ShowSavedRouteEditor(route, myWindow, func(edited routemanager.StaticRoute) {
+			if err := routemanager.UpdateRoute(edited); err != nil {
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			quickApply.Refresh()
+			routeTable.Refresh()
+			savedTable.Refresh()
+		})
+	}
+
+	// Cells edited inline are saved as soon as the user presses Enter.
+	savedTable.OnUpdate = func(route routemanager.StaticRoute) {
+		if err := routemanager.UpdateRoute(route); err != nil {
+			dialog.ShowError(err, myWindow)
+		}
+		quickApply.Refresh()
+		routeTable.Refresh()
+		savedTable.Refresh()
+	}
+
+	savedTable.OnSchedules = func() {
+		gui.ShowProfileSchedules(myWindow, func(profiles []routemanager.Profile) {
+			if err := routemanager.UpdateProfiles(profiles); err != nil {
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			// Bring the routes in line with the new windows right away.
+			if _, err := routemanager.ApplyActivation(time.Now()); err != nil {
+				dialog.ShowError(err, myWindow)
+			}
+			routeTable.Refresh()
+			savedTable.Refresh()
+		})
+	}
+
+	// Logic for the policy routing rules. The default rules are protected by both
+	// the table, which offers no action for them, and routemanager.DeleteRule.
+	rulesTable.OnNew = func() {
+		// New rules go into the namespace that is shown, and stay there.
+		rule := routemanager.Rule{Namespace: routemanager.CurrentNamespace()}
+		gui.ShowRuleEditor(rule, true, myWindow, func(rule routemanager.Rule, save bool) {
+			if err := routemanager.AddRule(rule); err != nil {
+				dialog.ShowError(err, myWindow)
+				return
+			}
+			if save {
+				if err := routemanager.AppendRules([]routemanager.Rule{rule}); err != nil {
+					dialog.ShowError(err, myWindow)
+				}
+			}
+			rulesTable.Refresh()
+		})
+	}
+
+	rulesTable.OnEdit = func(rule routemanager.Rule, live *routemanager.SystemRule) {
+		gui.ShowRuleEditor(rule, false, myWindow, func(edited routemanager.Rule, _ bool) {
+			if live != nil {
+				if err := routemanager.ReplaceRule(live.Rule, edited); err != nil {
+					dialog.ShowError(err, myWindow)
+					rulesTable.Refresh()
+					return
+				}
+			}
+			if edited.ID != "" {
+				if err := routemanager.UpdateRule(edited); err != nil {
+					dialog.ShowError(err, myWindow)
+				}
+			}
+			rulesTable.Refresh()
+		})
+	}
+
+	rulesTable.OnApply = func(rule routemanager.Rule) {
+		if err := routemanager.AddRule(rule); err != nil {
+			dialog.ShowError(err, myWindow)
+		}
+		rulesTable.Refresh()
+	}
+
+	rulesTable.OnRemove = func(rule routemanager.Rule) {
+		confirmMsg := fmt.Sprintf("Remove this rule from the system?\n\n%s", rule)
+		dialog.ShowConfirm("Confirm Removal", confirmMsg, func(confirm bool) {
+			if !confirm {
+				return
+			}
+			if err := routemanager.DeleteRule(rule); err != nil {
+				dialog.ShowError(err, myWindow)
+			}
+			rulesTable.Refresh()
+		}, myWindow)
+	}
+
+	rulesTable.OnSave = func(rule routemanager.Rule) {
+		if err := routemanager.AppendRules([]routemanager.Rule{rule}); err != nil {
+			dialog.ShowError(err, myWindow)
+		}
+		rulesTable.Refresh()
+	}
+
+	rulesTable.OnDelete = func(rule routemanager.Rule) {
+		confirmMsg := fmt.Sprintf("Permanently delete this rule from your saved rules?\n\n%s", rule)
+		dialog.ShowConfirm("Confirm Deletion", confirmMsg, func(confirm bool) {
+			if !confirm {
+				return
+			}
+			if err := routemanager.DeleteSavedRule(rule.ID); err != nil {
+				dialog.ShowError(err, myWindow)
+			}
+			rulesTable.Refresh()
+		}, myWindow)
+	}
+
+	rulesTable.OnSourceRouting = func() {
+		gui.ShowSourceRoutingWizard(myWindow, func(namespace string, setups []routemanager.SourceRoute) {
+			if err := routemanager.ConfigureSourceRoutes(namespace, setups); err != nil {
+				dialog.ShowError(err, myWindow)
+			}
+			routeTable.Refresh()
+			rulesTable.Refresh()
+		})
+	}
+
+	// Follow DHCP: when an interface gets a new address, its source routing moves along.
+	if _, err := routemanager.SyncSourceRoutes(); err != nil {
+		log.Printf("ERROR: Could not update source routing: %v", err)
+	}
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	err := routemanager.WatchSourceRoutes(stopWatching, func() {
+		fyne.Do(func() {
+			routeTable.Refresh()
+			rulesTable.Refresh()
+		})
+	})
+	if err != nil {
+		log.Printf("WARN: %v", err)
+	}
+
+	// Routes for interfaces that aren't there yet, such as a VPN tunnel, wait for them.
+	err = routemanager.WatchPendingRoutes(stopWatching, func() {
+		fyne.Do(func() {
+			routeTable.Refresh()
+			savedTable.Refresh()
+		})
+	})
+	if err != nil {
+		log.Printf("WARN: %v", err)
+	}
+
+	// VPN clients drop their routes on every reconnect; put the marked ones back.
+	err = routemanager.WatchTunnels(stopWatching, func() {
+		fyne.Do(func() {
+			routeTable.Refresh()
+			savedTable.Refresh()
+		})
+	})
+	if err != nil {
+		log.Printf("WARN: %v", err)
+	}
+
+	// Temporary routes go away when their time is up, also if that was while the app was closed.
+	routemanager.WatchSchedule(stopWatching, func() {
+		fyne.Do(routeTable.Refresh)
+	})
+
+	// Routes with activation windows, such as business hours, come and go on their own.
+	routemanager.WatchActivation(stopWatching, func() {
+		fyne.Do(func() {
+			routeTable.Refresh()
+			savedTable.Refresh()
+		})
+	})
+
+	// Logic for SWITCHING to another network namespace. Listing, the interface choices
+	// and new routes all follow; saved routes keep the namespace they were saved in.
+	namespaceSelector.OnSelected = func(namespace string) {
+		if err := routemanager.SetNamespace(namespace); err != nil {
+			dialog.ShowError(err, myWindow)
+			namespaceSelector.SetNamespace(routemanager.CurrentNamespace())
+			return
 		}
-		dialog.ShowConfirm("Confirm Deletion", "Are you sure you want to delete this route?", confirmCallback, myWindow)
+		header.RefreshInterfaces()
+		routeTable.Refresh()
+		rulesTable.Refresh()
 	}
 
 	// 3. Assemble the main layout
 	topPanel := container.NewVBox(
+		namespaceSelector.View,
 		header.View,
 		quickApply.View,
 	)
 
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Live Routes", routeTable),
+		container.NewTabItem("Saved Routes", savedTable),
+		container.NewTabItem("Rules", rulesTable),
+	)
+
 	content := container.NewBorder(
 		topPanel,
 		helpSection.View,
 		nil,
 		nil,
-		routeTable, // Use the new RouteTable component
+		tabs,
 	)
 
 	myWindow.SetContent(content)
 	myWindow.Resize(fyne.NewSize(900, 600))
 	myWindow.ShowAndRun()
 }
+
+// showBulkResult tells the user how a bulk operation went, listing every failed route.
+func showBulkResult(action string, total int, err error, window fyne.Window) {
+	if err == nil {
+		dialog.ShowInformation("Success", fmt.Sprintf("%s %d route(s).", action, total), window)
+		return
+	}
+	var batchErr *routemanager.BatchError
+	if errors.As(err, &batchErr) {
+		err = fmt.Errorf("%s %d of %d route(s). %w", action, total-len(batchErr.Failures), total, batchErr)
+	}
+	dialog.ShowError(err, window)
+}
+
+// showPending tells the user a route waits for its interface instead of being applied.
+func showPending(route routemanager.StaticRoute, window fyne.Window) {
+	msg := fmt.Sprintf("Interface %s isn't there yet.\n\nThe route is applied as soon as it comes up with an address.", route.Interface)
+	if expiry := gui.PendingExpiry(); expiry > 0 {
+		msg += fmt.Sprintf(" It waits until %s.", time.Now().Add(expiry).Format("Jan 2 15:04"))
+	}
+	dialog.ShowInformation("Route Pending", msg, window)
+}
+
+// routeList formats routes one per line for confirmation dialogs.
+func routeList(routes []routemanager.StaticRoute) string {
+	lines := make([]string, len(routes))
+	for i, r := range routes {
+		lines[i] = r.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,414 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profiles are saved next to the routes, in a file of their own.
+const profilesFile = "profiles.json"
+
+// activationCheckInterval caps how long the scheduler sleeps, so it notices a
+// changed clock or a resume from suspend within a minute.
+const activationCheckInterval = time.Minute
+
+// Saved routes can be active only during certain windows, such as business hours
+// or a maintenance window. A schedule lists windows separated by ";", each one
+// "<days> HH:MM-HH:MM" in local time:
+//
+//	mon-fri 09:00-18:00          weekdays, business hours
+//	sat,sun 22:00-06:00          weekend nights, the window runs past midnight
+//	* 12:00-13:00                every day
+//	2026-11-07 02:00-04:00       once, e.g. a maintenance window
+//
+// A route uses its own schedule or, without one, those of the profiles it is tagged with.
+
+// Window is one activation window of a schedule.
+type Window struct {
+	Days  [7]bool   // Indexed by time.Weekday; unused for a one-off window
+	Date  time.Time // Midnight of the day of a one-off window, zero otherwise
+	Start int       // Minutes after midnight
+	End   int       // Minutes after midnight; at or before Start the window ends the next day
+}
+
+// Profile puts every saved route tagged with its name on one schedule.
+type Profile struct {
+	Name         string `json:"name"` // The tag of its routes
+	ActiveDuring string `json:"active"`
+}
+
+// Transition is the next time the scheduler turns a route on or off.
+type Transition struct {
+	At       time.Time
+	Activate bool
+	Route    StaticRoute
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseWindows parses a schedule. An empty schedule has no windows.
+func ParseWindows(schedule string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(schedule, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		w, err := parseWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", part, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseWindow(text string) (Window, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return Window{}, errors.New(`expected "<days> HH:MM-HH:MM"`)
+	}
+	var w Window
+	if date, err := time.ParseInLocation("2006-01-02", fields[0], time.Local); err == nil {
+		w.Date = date
+	} else if w.Days, err = parseDays(fields[0]); err != nil {
+		return Window{}, err
+	}
+
+	start, end, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return Window{}, errors.New("expected a time range such as 09:00-18:00")
+	}
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return Window{}, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return Window{}, err
+	}
+	if w.Start == 24*60 {
+		return Window{}, errors.New("24:00 can only end a window, start it at 00:00 instead")
+	}
+	if w.Start == w.End {
+		return Window{}, errors.New("the window is empty")
+	}
+	return w, nil
+}
+
+// parseDays parses "*", a weekday, a range such as "mon-fri", or a list of those.
+func parseDays(text string) ([7]bool, error) {
+	var days [7]bool
+	if text == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, item := range strings.Split(strings.ToLower(text), ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first := slices.Index(weekdayNames, from)
+		last := first
+		if isRange {
+			last = slices.Index(weekdayNames, to)
+		}
+		if first < 0 || last < 0 {
+			return days, fmt.Errorf("unknown day %q, expected mon, tue, ... or a date", item)
+		}
+		// A range may wrap around the week, like fri-mon.
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseClock(text string) (int, error) {
+	hours, minutes, ok := strings.Cut(text, ":")
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	// 24:00 is allowed as the end of a day.
+	if !ok || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", text)
+	}
+	return h*60 + m, nil
+}
+
+// onDay reports whether the window starts on the day of t.
+func (w Window) onDay(t time.Time) bool {
+	if !w.Date.IsZero() {
+		y, m, d := t.Date()
+		wy, wm, wd := w.Date.Date()
+		return y == wy && m == wm && d == wd
+	}
+	return w.Days[t.Weekday()]
+}
+
+// Active reports whether t lies in the window.
+func (w Window) Active(t time.Time) bool {
+	t = t.Local()
+	minute := t.Hour()*60 + t.Minute()
+	if w.Start < w.End {
+		return w.onDay(t) && minute >= w.Start && minute < w.End
+	}
+	// Past midnight: the evening of the start day, or the morning after it.
+	return (w.onDay(t) && minute >= w.Start) || (w.onDay(t.AddDate(0, 0, -1)) && minute < w.End)
+}
+
+// ActiveAt reports whether any of the windows contains t.
+func ActiveAt(windows []Window, t time.Time) bool {
+	return slices.ContainsFunc(windows, func(w Window) bool { return w.Active(t) })
+}
+
+// NextTransition returns the first time after now at which the windows turn on or off,
+// looking a week ahead, or further for one-off windows.
+func NextTransition(windows []Window, now time.Time) (time.Time, bool) {
+	now = now.Local()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	horizon := 8
+	for _, w := range windows {
+		if days := int(w.Date.Sub(today).Hours()/24) + 2; days > horizon {
+			horizon = days
+		}
+	}
+
+	// Windows only change at their start or end, so those are the candidates. They are
+	// wall-clock times: on the days the clocks change, a day isn't 24 hours long.
+	var candidates []time.Time
+	for day := -1; day <= horizon; day++ {
+		y, m, d := today.AddDate(0, 0, day).Date()
+		for _, w := range windows {
+			for _, minute := range []int{w.Start, w.End} {
+				if c := time.Date(y, m, d, minute/60, minute%60, 0, 0, time.Local); c.After(now) {
+					candidates = append(candidates, c)
+				}
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+	activeNow := ActiveAt(windows, now)
+	for _, c := range candidates {
+		if ActiveAt(windows, c) != activeNow {
+			return c, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RouteWindows returns the windows a saved route is active in: its own, or those of
+// the profiles it is tagged with. A route without any is not scheduled (nil).
+func RouteWindows(route StaticRoute, profiles []Profile) ([]Window, error) {
+	if route.ActiveDuring != "" {
+		return ParseWindows(route.ActiveDuring)
+	}
+	var windows []Window
+	for _, p := range profiles {
+		if p.ActiveDuring == "" || !slices.Contains(route.Tags, p.Name) {
+			continue
+		}
+		w, err := ParseWindows(p.ActiveDuring)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		windows = append(windows, w...)
+	}
+	return windows, nil
+}
+
+// scheduledRoute is an enabled route that is only active during its windows.
+type scheduledRoute struct {
+	route    StaticRoute
+	resolved StaticRoute // With the interface its binding finds right now
+	windows  []Window
+}
+
+// scheduledRoutes returns the saved routes with windows, followed by those applied
+// from desired-state files, which come with the profiles of their file. A route that
+// is both follows its saved schedule. Routes whose windows can't be parsed are left
+// out and reported in problems.
+func scheduledRoutes() (scheduled []scheduledRoute, problems []error, err error) {
+	routes, err := LoadRoutes()
+	if err != nil {
+		return nil, nil, err
+	}
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	managed, err := loadManagedState()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	add := func(route, resolved StaticRoute, profiles []Profile) {
+		windows, err := RouteWindows(route, profiles)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", route, err))
+			return
+		}
+		if len(windows) > 0 && route.Enabled() {
+			scheduled = append(scheduled, scheduledRoute{route: route, resolved: resolved, windows: windows})
+		}
+	}
+	for i, resolved := range ResolveBindings(routes) {
+		add(routes[i], resolved, profiles)
+	}
+	for _, route := range managed.Routes {
+		if !slices.ContainsFunc(routes, route.SameRoute) {
+			add(route, route, managed.Profiles)
+		}
+	}
+	return scheduled, problems, nil
+}
+
+// UpcomingTransitions lists when each scheduled, enabled route turns on or off next, soonest first.
+func UpcomingTransitions(now time.Time) ([]Transition, error) {
+	scheduled, _, err := scheduledRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	var transitions []Transition
+	for _, s := range scheduled {
+		if at, ok := NextTransition(s.windows, now); ok {
+			transitions = append(transitions, Transition{At: at, Activate: !ActiveAt(s.windows, now), Route: s.route})
+		}
+	}
+	sort.SliceStable(transitions, func(i, j int) bool { return transitions[i].At.Before(transitions[j].At) })
+	return transitions, nil
+}
+
+// ApplyActivation adds the scheduled routes that should be active now and removes
+// the ones that shouldn't, both saved ones and those applied from desired-state files.
+// It compares against the kernel rather than remembering what it did, so a jump of
+// the clock or a resume from suspend is caught up with. It reports how many routes
+// it changed.
+func ApplyActivation(now time.Time) (int, error) {
+	scheduled, errs, err := scheduledRoutes()
+	if err != nil {
+		return 0, err
+	}
+
+	live := map[string][]SystemRoute{}
+	changed := 0
+	for _, s := range scheduled {
+		route := s.route
+		if _, ok := live[route.Namespace]; !ok {
+			live[route.Namespace] = ListSystemRoutesIn(route.Namespace)
+		}
+		isActive := SavedRouteState(s.resolved, live[route.Namespace]) == StateActive
+		wantActive := ActiveAt(s.windows, now)
+
+		switch {
+		case wantActive && !isActive:
+			if err := Add(route); err != nil {
+				// The interface may be unplugged outside business hours; try again later.
+				if !errors.Is(err, ErrInterfaceNotFound) {
+					errs = append(errs, fmt.Errorf("could not activate %s: %w", route, err))
+				}
+				continue
+			}
+			log.Printf("Activated scheduled route %s", route)
+			if err := MarkApplied(route); err != nil {
+				log.Printf("WARN: Could not record when the route was applied: %v", err)
+			}
+			changed++
+		case !wantActive && isActive:
+			if err := Delete(route); err != nil {
+				errs = append(errs, fmt.Errorf("could not deactivate %s: %w", route, err))
+				continue
+			}
+			log.Printf("Deactivated scheduled route %s", route)
+			changed++
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// WatchActivation keeps the scheduled routes in line with their windows until done
+// is closed. onChange is called after routes were activated or deactivated.
+func WatchActivation(done <-chan struct{}, onChange func()) {
+	go func() {
+		for {
+			now := time.Now()
+			changed, err := ApplyActivation(now)
+			if err != nil {
+				log.Printf("ERROR: Could not apply route schedules: %v", err)
+			}
+			if changed > 0 && onChange != nil {
+				onChange()
+			}
+
+			// Wake up just after the next transition, but at least every minute.
+			wait := activationCheckInterval
+			if transitions, err := UpcomingTransitions(now); err == nil && len(transitions) > 0 {
+				wait = min(max(transitions[0].At.Sub(now), 0)+time.Second, wait)
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// UpdateProfiles gives the named profiles their new schedules in one locked
+// read-modify-write of profiles.json. A profile with an empty schedule is removed;
+// profiles that aren't named stay as they are.
+func UpdateProfiles(updated []Profile) error {
+	dir := StoreDir()
+	return withStoreLock(dir, func() error {
+		profiles, err := LoadProfiles()
+		if err != nil {
+			return err
+		}
+		for _, u := range updated {
+			profiles = slices.DeleteFunc(profiles, func(p Profile) bool { return p.Name == u.Name })
+			if u.ActiveDuring != "" {
+				profiles = append(profiles, u)
+			}
+		}
+		return saveProfiles(profiles)
+	})
+}
+
+// saveProfiles overwrites profiles.json with the given profiles.
+// The caller holds the store's lock.
+func saveProfiles(profiles []Profile) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFile(StoreDir(), profilesFile, data)
+}
+
+// LoadProfiles reads the saved profiles. A missing file means there are none.
+func LoadProfiles() ([]Profile, error) {
+	data, err := readStoreFile(StoreDir(), profilesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Profile{}, nil
+		}
+		return nil, err
+	}
+
+	var profiles []Profile
+	if err = json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
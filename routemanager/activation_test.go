@@ -0,0 +1,192 @@
+package routemanager
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Europe/Berlin on machines without zoneinfo
+)
+
+// inBerlin runs the test in a time zone with daylight saving time, which changes
+// on 2026-03-29 (02:00 → 03:00) and 2026-10-25 (03:00 → 02:00).
+func inBerlin(t *testing.T) {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = local })
+}
+
+// at is a wall-clock time in the test's time zone, e.g. "2026-10-19 09:00".
+func at(t *testing.T, text string) time.Time {
+	t.Helper()
+	when, err := time.ParseInLocation("2006-01-02 15:04", text, time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return when
+}
+
+func TestParseWindows(t *testing.T) {
+	inBerlin(t)
+	weekdays := [7]bool{false, true, true, true, true, true, false}
+	weekend := [7]bool{true, false, false, false, false, false, true}
+	everyDay := [7]bool{true, true, true, true, true, true, true}
+	friToMon := [7]bool{true, true, false, false, false, true, true}
+
+	tests := []struct {
+		schedule string
+		want     []Window
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{" ; ", nil, false},
+		{"mon-fri 09:00-18:00", []Window{{Days: weekdays, Start: 540, End: 1080}}, false},
+		{"SAT,sun 22:00-06:00", []Window{{Days: weekend, Start: 1320, End: 360}}, false},
+		{"fri-mon 00:00-24:00", []Window{{Days: friToMon, Start: 0, End: 1440}}, false},
+		{"* 12:00-13:00; sat 08:30-09:00", []Window{
+			{Days: everyDay, Start: 720, End: 780},
+			{Days: [7]bool{6: true}, Start: 510, End: 540},
+		}, false},
+		{"2026-11-07 02:00-04:00", []Window{{Date: at(t, "2026-11-07 00:00"), Start: 120, End: 240}}, false},
+		{"mon 00:00-24:00", []Window{{Days: [7]bool{1: true}, Start: 0, End: 1440}}, false},
+
+		// Every mistake the syntax in the README rules out.
+		{"mon-fri", nil, true},                          // No times
+		{"09:00-18:00", nil, true},                      // No days
+		{"mon-fri 09:00-18:00 extra", nil, true},        // Too many fields
+		{"someday 09:00-18:00", nil, true},              // Unknown day
+		{"mon-xyz 09:00-18:00", nil, true},              // Unknown end of a range
+		{"xyz-fri 09:00-18:00", nil, true},              // Unknown start of a range
+		{"-fri 09:00-18:00", nil, true},                 // Range without a start
+		{"mon, 09:00-18:00", nil, true},                 // Empty list item
+		{"mon,,tue 09:00-18:00", nil, true},             // Empty list item
+		{"2026-13-01 02:00-04:00", nil, true},           // Invalid date
+		{"2026-02-30 02:00-04:00", nil, true},           // Invalid date
+		{"mon-fri 09:00", nil, true},                    // No range
+		{"mon 09:00-", nil, true},                       // No end
+		{"mon -18:00", nil, true},                       // No start
+		{"mon 9-18", nil, true},                         // Not HH:MM
+		{"mon ab:00-18:00", nil, true},                  // Not a number
+		{"mon 09:00-18:xy", nil, true},                  // Not a number
+		{"mon 09:60-18:00", nil, true},                  // Minute out of range
+		{"mon 09:00--1:00", nil, true},                  // Negative
+		{"mon 25:00-06:00", nil, true},                  // Hour out of range
+		{"mon 24:30-18:00", nil, true},                  // Past the end of the day
+		{"mon 09:00-24:01", nil, true},                  // Past the end of the day
+		{"mon 24:00-06:00", nil, true},                  // 24:00 only ends a window
+		{"mon 09:00-09:00", nil, true},                  // Empty window
+		{"mon 09:00-18:00; tue", nil, true},             // One bad window spoils the schedule
+		{"mon 09:00-18:00, tue 09:00-18:00", nil, true}, // Windows are separated by ";"
+	}
+	for _, tt := range tests {
+		got, err := ParseWindows(tt.schedule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWindows(%q) error = %v, want error %v", tt.schedule, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseWindows(%q) = %+v, want %+v", tt.schedule, got, tt.want)
+			continue
+		}
+		for i := range got {
+			g, w := got[i], tt.want[i]
+			if g.Days != w.Days || !g.Date.Equal(w.Date) || g.Start != w.Start || g.End != w.End {
+				t.Errorf("ParseWindows(%q)[%d] = %+v, want %+v", tt.schedule, i, g, w)
+			}
+		}
+	}
+}
+
+func TestActiveAt(t *testing.T) {
+	inBerlin(t)
+	tests := []struct {
+		schedule string
+		when     string
+		want     bool
+	}{
+		{"mon-fri 09:00-18:00", "2026-10-19 09:00", true}, // Monday, the start is included
+		{"mon-fri 09:00-18:00", "2026-10-19 17:59", true},
+		{"mon-fri 09:00-18:00", "2026-10-19 18:00", false}, // The end is not
+		{"mon-fri 09:00-18:00", "2026-10-19 08:59", false},
+		{"mon-fri 09:00-18:00", "2026-10-24 12:00", false}, // Saturday
+
+		// Past midnight the window belongs to the day it started on.
+		{"fri 22:00-06:00", "2026-10-23 23:30", true},  // Friday night
+		{"fri 22:00-06:00", "2026-10-24 05:59", true},  // Saturday morning
+		{"fri 22:00-06:00", "2026-10-24 06:00", false}, // Over
+		{"fri 22:00-06:00", "2026-10-23 05:00", false}, // Friday morning belongs to Thursday
+		{"fri 22:00-06:00", "2026-10-24 23:00", false}, // Saturday night
+
+		{"fri-mon 00:00-24:00", "2026-10-26 23:59", true}, // Monday
+		{"fri-mon 00:00-24:00", "2026-10-27 00:00", false},
+		{"* 12:00-13:00", "2026-10-21 12:30", true},
+		{"2026-11-07 02:00-04:00", "2026-11-07 03:00", true},
+		{"2026-11-07 02:00-04:00", "2026-11-14 03:00", false}, // A week later
+		{"mon 08:00-09:00; mon 17:00-18:00", "2026-10-19 17:15", true},
+		{"mon 08:00-09:00; mon 17:00-18:00", "2026-10-19 12:00", false},
+
+		// On the day the clocks go forward, 03:30 is 1.5 hours after midnight.
+		{"sun 03:00-04:00", "2026-03-29 03:30", true},
+		{"sun 01:00-03:00", "2026-03-29 03:30", false},
+	}
+	for _, tt := range tests {
+		windows, err := ParseWindows(tt.schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ActiveAt(windows, at(t, tt.when)); got != tt.want {
+			t.Errorf("ActiveAt(%q, %s) = %v, want %v", tt.schedule, tt.when, got, tt.want)
+		}
+	}
+}
+
+func TestNextTransition(t *testing.T) {
+	inBerlin(t)
+	tests := []struct {
+		schedule string
+		now      string
+		want     string // Empty for no transition
+	}{
+		{"mon-fri 09:00-18:00", "2026-10-19 08:00", "2026-10-19 09:00"},
+		{"mon-fri 09:00-18:00", "2026-10-19 09:00", "2026-10-19 18:00"},
+		{"mon-fri 09:00-18:00", "2026-10-23 18:30", "2026-10-26 09:00"}, // Friday evening to Monday
+
+		// Windows running past midnight end on the next day, also across a week boundary.
+		{"fri 22:00-06:00", "2026-10-23 23:00", "2026-10-24 06:00"},
+		{"sun 22:00-06:00", "2026-10-18 22:00", "2026-10-19 06:00"},
+		{"* 22:00-06:00", "2026-10-20 06:00", "2026-10-20 22:00"},
+
+		// Back-to-back windows are one stretch.
+		{"mon 08:00-12:00; mon 12:00-14:00", "2026-10-19 09:00", "2026-10-19 14:00"},
+
+		{"2026-11-07 02:00-04:00", "2026-10-19 12:00", "2026-11-07 02:00"},
+		{"2026-11-07 02:00-04:00", "2026-11-07 04:00", ""},
+
+		// On the days daylight saving time starts and ends, the window still follows the clock.
+		{"* 01:00-04:00", "2026-03-29 01:30", "2026-03-29 04:00"},
+		{"* 05:00-06:00", "2026-03-29 00:30", "2026-03-29 05:00"},
+		{"* 01:00-04:00", "2026-10-25 01:30", "2026-10-25 04:00"},
+		{"* 22:00-06:00", "2026-10-24 23:00", "2026-10-25 06:00"},
+	}
+	for _, tt := range tests {
+		windows, err := ParseWindows(tt.schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := NextTransition(windows, at(t, tt.now))
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("NextTransition(%q, %s) = %s, want none", tt.schedule, tt.now, got)
+		case tt.want != "" && !ok:
+			t.Errorf("NextTransition(%q, %s) found none, want %s", tt.schedule, tt.now, tt.want)
+		case tt.want != "" && !got.Equal(at(t, tt.want)):
+			t.Errorf("NextTransition(%q, %s) = %s, want %s", tt.schedule, tt.now, got, at(t, tt.want))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package routemanager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// RouteError is the failure of a single route within a batch.
+type RouteError struct {
+	Route StaticRoute
+	Err   error
+}
+
+// BatchError is returned by batch operations when some of the routes failed.
+// The routes that are not listed here were processed successfully.
+type BatchError struct {
+	Total    int
+	Failures []RouteError
+}
+
+func (e *BatchError) Error() string {
+	lines := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		lines[i] = fmt.Sprintf("%s: %v", f.Route.Destination, f.Err)
+	}
+	return fmt.Sprintf("%d of %d route(s) failed:\n%s", len(e.Failures), e.Total, strings.Join(lines, "\n"))
+}
+
+// Batch runs op for every route, carrying on after failures.
+// It returns nil if all routes succeeded, or a *BatchError listing the ones that didn't.
+func Batch(routes []StaticRoute, op func(StaticRoute) error) error {
+	batchErr := &BatchError{Total: len(routes)}
+	for _, route := range routes {
+		if err := op(route); err != nil {
+			batchErr.Failures = append(batchErr.Failures, RouteError{Route: route, Err: err})
+		}
+	}
+	if len(batchErr.Failures) == 0 {
+		return nil
+	}
+	return batchErr
+}
+
+// DeleteAll removes several routes over a single netlink socket.
+// Every route is attempted, so one stale route doesn't block the rest.
+func DeleteAll(routes []StaticRoute) error {
+	return batchWithHandle(routes, deleteWith)
+}
+
+// batchWithHandle opens one socket per namespace the routes live in.
+func batchWithHandle(routes []StaticRoute, op func(*netlink.Handle, StaticRoute) error) error {
+	handles := map[string]*netlink.Handle{}
+	defer func() {
+		for _, h := range handles {
+			h.Close()
+		}
+	}()
+
+	return Batch(routes, func(route StaticRoute) error {
+		h, ok := handles[route.Namespace]
+		if !ok {
+			var err error
+			if route.Namespace == "" {
+				h, err = netlink.NewHandle()
+			} else {
+				h, err = handleFor(route.Namespace)
+			}
+			if err != nil {
+				return fmt.Errorf("could not open netlink socket: %w", err)
+			}
+			handles[route.Namespace] = h
+		}
+		return op(h, route)
+	})
+}
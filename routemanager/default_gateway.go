@@ -0,0 +1,227 @@
+package routemanager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultProbeTarget is contacted after switching the default gateway. It is an IP
+// address on purpose, so the check doesn't depend on DNS working through the new route.
+const DefaultProbeTarget = "1.1.1.1:443"
+
+// ErrProbeFailed is returned when the network was unreachable through the new default
+// gateway. The previous default routes have been restored by then.
+var ErrProbeFailed = errors.New("connectivity check failed, the previous default route was restored")
+
+// SwitchMode is how SwitchDefaultGateway moves the default route.
+type SwitchMode int
+
+const (
+	// SwitchByMetric keeps the other default routes as fallbacks, with a higher metric.
+	SwitchByMetric SwitchMode = iota
+	// SwitchByReplace removes the other default routes.
+	SwitchByReplace
+)
+
+// IsDefault reports whether this is a default route of the main table. Those can
+// only be changed through SwitchDefaultGateway, which checks the host stays online.
+func (r SystemRoute) IsDefault() bool {
+	return r.Destination == "0.0.0.0/0" && tableOrMain(r.Table) == MainTable
+}
+
+// SwitchDefaultGateway makes gateway on iface the default route of the main table of
+// a namespace, "" being the host's. Afterwards it connects to probe (host:port) from
+// that namespace; if that fails within timeout, every default route is put back the
+// way it was and ErrProbeFailed is returned.
+func SwitchDefaultGateway(namespace, gateway, iface string, mode SwitchMode, probe string, timeout time.Duration) error {
+	h, err := handleFor(namespace)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	before, err := mainDefaultRoutes(h)
+	if err != nil {
+		return err
+	}
+
+	if err := switchDefault(h, before, gateway, iface, mode); err != nil {
+		if restoreErr := restoreDefaults(h, before); restoreErr != nil {
+			return fmt.Errorf("%w; restoring the previous default route failed too: %w", err, restoreErr)
+		}
+		return err
+	}
+
+	if err := ProbeIn(namespace, probe, timeout); err != nil {
+		if restoreErr := restoreDefaults(h, before); restoreErr != nil {
+			return fmt.Errorf("connectivity check failed (%w) and the previous default route could not be restored: %w", err, restoreErr)
+		}
+		return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	return nil
+}
+
+// switchDefault installs the new default route and demotes or removes the others.
+func switchDefault(h *netlink.Handle, current []netlink.Route, gateway, iface string, mode SwitchMode) error {
+	link, err := h.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("could not find interface %s: %w", iface, err)
+	}
+	gw := net.ParseIP(gateway)
+	if gw == nil {
+		return fmt.Errorf("invalid gateway IP: %s", gateway)
+	}
+	isTarget := func(r netlink.Route) bool {
+		return r.LinkIndex == link.Attrs().Index && r.Gw.Equal(gw)
+	}
+
+	// With metrics the new route has to beat every other default route. The kernel
+	// prefers the lowest metric, so take one below the best of the others.
+	metric := 0
+	if mode == SwitchByMetric {
+		var others []int
+		for _, r := range current {
+			if !isTarget(r) {
+				others = append(others, r.Priority)
+			}
+		}
+		if len(others) > 0 {
+			best := slices.Min(others)
+			if best == 0 {
+				return errors.New("another default route already has metric 0; switch by replacing it instead")
+			}
+			metric = best - 1
+		}
+	}
+
+	_, dst, _ := net.ParseCIDR("0.0.0.0/0")
+	route := &netlink.Route{Dst: dst, Gw: gw, LinkIndex: link.Attrs().Index, Priority: metric}
+	if err := h.RouteReplace(route); err != nil {
+		return fmt.Errorf("failed to add default route via %s: %w", gateway, err)
+	}
+
+	for _, r := range current {
+		switch {
+		case isTarget(r) && r.Priority == metric:
+			// That is the route we just replaced.
+		case isTarget(r) || mode == SwitchByReplace:
+			// ESRCH: the new route had the same metric and already took its place.
+			if err := h.RouteDel(&r); err != nil && !errors.Is(err, unix.ESRCH) {
+				return fmt.Errorf("failed to remove old default route via %s: %w", r.Gw, err)
+			}
+		}
+	}
+	return nil
+}
+
+// restoreDefaults puts the default routes of the main table back to what they were.
+func restoreDefaults(h *netlink.Handle, before []netlink.Route) error {
+	var errs []error
+	for _, r := range before {
+		if err := h.RouteReplace(&r); err != nil {
+			errs = append(errs, fmt.Errorf("could not restore default route via %s: %w", r.Gw, err))
+		}
+	}
+	now, err := mainDefaultRoutes(h)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, r := range now {
+		if !slices.ContainsFunc(before, func(b netlink.Route) bool { return sameDefault(b, r) }) {
+			if err := h.RouteDel(&r); err != nil {
+				errs = append(errs, fmt.Errorf("could not remove default route via %s: %w", r.Gw, err))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		log.Printf("WARN: Restored the previous default routes")
+	}
+	return errors.Join(errs...)
+}
+
+// mainDefaultRoutes lists the IPv4 default routes of the main table.
+func mainDefaultRoutes(h *netlink.Handle) ([]netlink.Route, error) {
+	routes, err := h.RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, fmt.Errorf("could not list default routes: %w", err)
+	}
+	var defaults []netlink.Route
+	for _, r := range routes {
+		if r.Dst == nil || (r.Dst.IP.IsUnspecified() && isZeroMask(r.Dst.Mask)) {
+			defaults = append(defaults, r)
+		}
+	}
+	return defaults, nil
+}
+
+func sameDefault(a, b netlink.Route) bool {
+	return a.LinkIndex == b.LinkIndex && a.Gw.Equal(b.Gw) && a.Priority == b.Priority
+}
+
+func isZeroMask(mask net.IPMask) bool {
+	ones, _ := mask.Size()
+	return ones == 0
+}
+
+// Probe checks that target (host:port, or a host, which means port 443) accepts
+// a TCP connection within timeout.
+func Probe(target string, timeout time.Duration) error {
+	return ProbeIn("", target, timeout)
+}
+
+// ProbeIn is Probe from inside a namespace, "" being the host's.
+func ProbeIn(namespace, target string, timeout time.Duration) error {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "443")
+	}
+	conn, err := dialIn(namespace, target, timeout)
+	if err != nil {
+		return fmt.Errorf("could not reach %s: %w", target, err)
+	}
+	return conn.Close()
+}
+
+// dialIn opens a TCP connection from inside a namespace. A socket stays in the
+// namespace it was created in, so only the dial runs on a thread moved there. The
+// dial must not spread over other goroutines, hence no parallel IPv4/IPv6 attempts.
+func dialIn(namespace, target string, timeout time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: timeout, FallbackDelay: -1}
+	if namespace == "" {
+		return dialer.Dial("tcp", target)
+	}
+	ns, err := openNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer ns.Close()
+
+	runtime.LockOSThread()
+	host, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("could not open the current network namespace: %w", err)
+	}
+	defer host.Close()
+	if err := netns.Set(ns); err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("could not enter network namespace %s: %w", namespace, err)
+	}
+	conn, err := dialer.Dial("tcp", target)
+	// A thread that can't go back stays locked, so it dies with this goroutine
+	// instead of running others in the wrong namespace.
+	if restoreErr := netns.Set(host); restoreErr != nil {
+		log.Printf("WARN: Could not leave network namespace %s: %v", namespace, restoreErr)
+	} else {
+		runtime.UnlockOSThread()
+	}
+	return conn, err
+}
@@ -0,0 +1,538 @@
+package routemanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// A desired-state file declares routes, rules, profiles and table names in YAML or
+// TOML, so a setup can be kept in git and reviewed like code. PlanState compares it
+// with the kernel and ApplyPlan converges the kernel to it:
+//
+//	tables:
+//	  vpn: 100
+//	profiles:
+//	  office: mon-fri 09:00-18:00
+//	routes:
+//	  - destination: 10.0.0.0/8
+//	    via: 192.168.1.1
+//	    dev: eth1
+//	    metric: 100
+//	    tags: [office]
+//	rules:
+//	  - from: 192.168.1.0/24
+//	    table: vpn
+//
+// The TOML form has the same keys under [tables], [profiles], [[routes]] and [[rules]].
+// Tables declared in the file are only names for the file, rt_tables is left alone.
+
+// DesiredState is a validated desired-state file.
+type DesiredState struct {
+	Routes   []StaticRoute
+	Rules    []Rule
+	Profiles []Profile
+}
+
+// StateProblem is one mistake in a desired-state file.
+type StateProblem struct {
+	Line    int // 0 when the line isn't known
+	Message string
+}
+
+// StateFileError lists every mistake found in a desired-state file, so they can be fixed in one go.
+type StateFileError struct {
+	Path     string
+	Problems []StateProblem
+}
+
+func (e *StateFileError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		if p.Line > 0 {
+			lines[i] = fmt.Sprintf("%s:%d: %s", e.Path, p.Line, p.Message)
+		} else {
+			lines[i] = fmt.Sprintf("%s: %s", e.Path, p.Message)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stateFile is a desired-state file as written, before validation.
+type stateFile struct {
+	Tables   map[string]int    `yaml:"tables" toml:"tables"`
+	Profiles map[string]string `yaml:"profiles" toml:"profiles"`
+	Routes   []stateRoute      `yaml:"routes" toml:"routes"`
+	Rules    []stateRule       `yaml:"rules" toml:"rules"`
+}
+
+// stateRoute is a route in a desired-state file. The keys follow `ip route`.
+type stateRoute struct {
+	Destination  string     `yaml:"destination" toml:"destination"`
+	Type         string     `yaml:"type" toml:"type"`
+	Gateway      string     `yaml:"via" toml:"via"`
+	Interface    string     `yaml:"dev" toml:"dev"`
+	OnLink       bool       `yaml:"onlink" toml:"onlink"`
+	NextHops     []string   `yaml:"nexthops" toml:"nexthops"` // One "via ... dev ... weight ..." each
+	Metric       int        `yaml:"metric" toml:"metric"`
+	Src          string     `yaml:"src" toml:"src"`
+	Table        scalarText `yaml:"table" toml:"table"`
+	Namespace    string     `yaml:"netns" toml:"netns"`
+	MTU          int        `yaml:"mtu" toml:"mtu"`
+	AdvMSS       int        `yaml:"advmss" toml:"advmss"`
+	InitCwnd     int        `yaml:"initcwnd" toml:"initcwnd"`
+	InitRwnd     int        `yaml:"initrwnd" toml:"initrwnd"`
+	Congestion   string     `yaml:"congctl" toml:"congctl"`
+	Description  string     `yaml:"description" toml:"description"`
+	Tags         []string   `yaml:"tags" toml:"tags"`
+	Disabled     bool       `yaml:"disabled" toml:"disabled"`
+	ActiveDuring string     `yaml:"active" toml:"active"`
+}
+
+// stateRule is a rule in a desired-state file. The keys follow `ip rule`.
+type stateRule struct {
+	Priority    int        `yaml:"priority" toml:"priority"`
+	From        string     `yaml:"from" toml:"from"`
+	To          string     `yaml:"to" toml:"to"`
+	FwMark      scalarText `yaml:"fwmark" toml:"fwmark"` // "0x10" or "0x10/0xff"
+	Iif         string     `yaml:"iif" toml:"iif"`
+	Oif         string     `yaml:"oif" toml:"oif"`
+	UIDRange    scalarText `yaml:"uidrange" toml:"uidrange"` // "1000" or "1000-1999"
+	Table       scalarText `yaml:"table" toml:"table"`
+	Namespace   string     `yaml:"netns" toml:"netns"`
+	Description string     `yaml:"description" toml:"description"`
+}
+
+// scalarText is a value that may be written as text or as a number, such as a
+// table name or ID. YAML does that by itself, TOML needs to be told.
+type scalarText string
+
+func (s *scalarText) UnmarshalTOML(value any) error {
+	switch v := value.(type) {
+	case string:
+		*s = scalarText(v)
+	case int64:
+		*s = scalarText(strconv.FormatInt(v, 10))
+	default:
+		return fmt.Errorf("expected text or a number, not %T", value)
+	}
+	return nil
+}
+
+// LoadDesiredState reads and validates a desired-state file. Files ending in .toml
+// are TOML, anything else is YAML. The mistakes found are returned together, each
+// with its line, as a *StateFileError.
+func LoadDesiredState(path string) (DesiredState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DesiredState{}, err
+	}
+
+	var file stateFile
+	var lines stateLines
+	var problems []StateProblem
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		file, lines, problems = decodeTOML(data)
+	} else {
+		file, lines, problems = decodeYAML(data)
+	}
+
+	// Without lines the file couldn't even be parsed.
+	var state DesiredState
+	if lines != nil {
+		var more []StateProblem
+		state, more = file.validate(lines)
+		problems = append(problems, more...)
+	}
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+		return DesiredState{}, &StateFileError{Path: path, Problems: problems}
+	}
+	return state, nil
+}
+
+// validate checks everything the decoder can't and turns the file into routes, rules and profiles.
+func (f stateFile) validate(lines stateLines) (DesiredState, []StateProblem) {
+	var state DesiredState
+	var problems []StateProblem
+	report := func(line int, format string, args ...any) {
+		problems = append(problems, StateProblem{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// 1. TABLES
+	for name, id := range f.Tables {
+		if _, err := strconv.Atoi(name); err == nil {
+			report(lines.line("tables", -1, name), "table name %q is a number", name)
+		}
+		if id <= 0 || int64(id) > 1<<32-1 {
+			report(lines.line("tables", -1, name), "table %s has an invalid ID %d", name, id)
+		}
+	}
+	table := func(ref scalarText) (int, error) {
+		if id, ok := f.Tables[string(ref)]; ok {
+			if id == MainTable {
+				return 0, nil // Stored like ParseTable does
+			}
+			return id, nil
+		}
+		return ParseTable(string(ref))
+	}
+
+	// 2. PROFILES
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if _, err := ParseWindows(f.Profiles[name]); err != nil {
+			report(lines.line("profiles", -1, name), "profile %s: %v", name, err)
+			continue
+		}
+		state.Profiles = append(state.Profiles, Profile{Name: name, ActiveDuring: f.Profiles[name]})
+	}
+
+	// 3. ROUTES
+	var routeIndexes []int // The entry in the file of every route in state.Routes
+	for i, r := range f.Routes {
+		at := func(key string) int { return lines.line("routes", i, key) }
+		before := len(problems)
+		route := StaticRoute{
+			Type:        r.Type,
+			Interface:   r.Interface,
+			Gateway:     r.Gateway,
+			OnLink:      r.OnLink,
+			Metric:      r.Metric,
+			Src:         r.Src,
+			Namespace:   r.Namespace,
+			Description: r.Description,
+			Tags:        r.Tags,
+			Disabled:    r.Disabled,
+			PathAttributes: PathAttributes{
+				MTU: r.MTU, AdvMSS: r.AdvMSS, InitCwnd: r.InitCwnd, InitRwnd: r.InitRwnd, Congestion: r.Congestion,
+			},
+			ActiveDuring: r.ActiveDuring,
+		}
+
+		if r.Destination == "" {
+			report(at(""), "route without a destination")
+		} else if dst, err := NormalizeCIDR(r.Destination); err != nil {
+			report(at("destination"), "%v", err)
+		} else {
+			route.Destination = dst
+		}
+		if !slices.Contains(RouteTypes, r.Type) {
+			report(at("type"), "unknown route type %q, expected one of %s", r.Type, strings.Join(RouteTypes[1:], ", "))
+		}
+		switch {
+		case IsSpecialType(r.Type):
+			if r.Interface != "" || r.Gateway != "" || len(r.NextHops) > 0 {
+				report(at("type"), "a %s route has no dev, via or nexthops", r.Type)
+			}
+		case len(r.NextHops) > 0:
+			if r.Interface != "" || r.Gateway != "" {
+				report(at("nexthops"), "a multipath route takes dev and via from its nexthops")
+			}
+			hops, err := ParseNextHops(strings.Join(r.NextHops, "\n"))
+			if err != nil {
+				report(at("nexthops"), "%v", err)
+			}
+			route.NextHops = hops
+		case r.Interface == "":
+			report(at(""), "route without a dev or nexthops")
+		}
+		if r.Gateway != "" && net.ParseIP(r.Gateway) == nil {
+			report(at("via"), "invalid gateway %q", r.Gateway)
+		}
+		if r.Src != "" && net.ParseIP(r.Src) == nil {
+			report(at("src"), "invalid source address %q", r.Src)
+		}
+		for _, attr := range []struct {
+			key   string
+			value int
+		}{{"metric", r.Metric}, {"mtu", r.MTU}, {"advmss", r.AdvMSS}, {"initcwnd", r.InitCwnd}, {"initrwnd", r.InitRwnd}} {
+			if attr.value < 0 {
+				report(at(attr.key), "%s can't be negative", attr.key)
+			}
+		}
+		var err error
+		if route.Table, err = table(r.Table); err != nil {
+			report(at("table"), "%v", err)
+		}
+		if _, err := ParseWindows(r.ActiveDuring); err != nil {
+			report(at("active"), "%v", err)
+		}
+		if len(problems) > before {
+			continue
+		}
+		if j := slices.IndexFunc(state.Routes, route.SameRoute); j >= 0 {
+			report(at(""), "the same route as on line %d", lines.line("routes", routeIndexes[j], ""))
+			continue
+		}
+		state.Routes = append(state.Routes, route)
+		routeIndexes = append(routeIndexes, i)
+	}
+
+	// 4. RULES
+	var ruleIndexes []int
+	for i, r := range f.Rules {
+		at := func(key string) int { return lines.line("rules", i, key) }
+		before := len(problems)
+		rule := Rule{Priority: r.Priority, Iif: r.Iif, Oif: r.Oif, Namespace: r.Namespace, Description: r.Description}
+
+		if r.Priority < 0 {
+			report(at("priority"), "priority can't be negative")
+		}
+		for _, prefix := range []struct {
+			key, text string
+			dst       *string
+		}{{"from", r.From, &rule.From}, {"to", r.To, &rule.To}} {
+			if prefix.text == "" || prefix.text == "all" {
+				continue
+			}
+			normalized, err := NormalizeCIDR(prefix.text)
+			if err != nil {
+				report(at(prefix.key), "%v", err)
+			}
+			*prefix.dst = normalized
+		}
+		var err error
+		if r.FwMark != "" {
+			if rule.FwMark, rule.FwMask, err = ParseFwMark(string(r.FwMark)); err != nil {
+				report(at("fwmark"), "%v", err)
+			}
+		}
+		if r.UIDRange != "" {
+			if rule.UIDRange, err = ParseUIDRange(string(r.UIDRange)); err != nil {
+				report(at("uidrange"), "%v", err)
+			}
+		}
+		if rule.Table, err = table(r.Table); err != nil {
+			report(at("table"), "%v", err)
+		}
+		if len(problems) > before {
+			continue
+		}
+		if rule.IsDefault() {
+			report(at(""), "the kernel's default rules can't be managed")
+			continue
+		}
+		if j := slices.IndexFunc(state.Rules, rule.SameRule); j >= 0 {
+			report(at(""), "the same rule as on line %d", lines.line("rules", ruleIndexes[j], ""))
+			continue
+		}
+		state.Rules = append(state.Rules, rule)
+		ruleIndexes = append(ruleIndexes, i)
+	}
+	return state, problems
+}
+
+// stateLines finds where an entry of a section, or one of its keys, is written.
+// index is the entry of a list such as routes, -1 for a table such as profiles.
+// It returns 0 when it can't tell.
+type stateLines interface {
+	line(section string, index int, key string) int
+}
+
+var (
+	// yaml.v3 puts the line into its messages rather than into a field.
+	yamlLinePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+	yamlUnknownKey = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// decodeYAML decodes a YAML file, rejecting unknown keys.
+func decodeYAML(data []byte) (stateFile, stateLines, []StateProblem) {
+	var file stateFile
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return file, nil, yamlProblems(err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var problems []StateProblem
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		problems = yamlProblems(err)
+	}
+	return file, yamlLines{&root}, problems
+}
+
+// yamlProblems splits a yaml.v3 error into one problem per message.
+func yamlProblems(err error) []StateProblem {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	problems := make([]StateProblem, len(messages))
+	for i, msg := range messages {
+		if m := yamlLinePrefix.FindStringSubmatch(msg); m != nil {
+			problems[i].Line, _ = strconv.Atoi(m[1])
+			msg = msg[len(m[0]):]
+		}
+		problems[i].Message = yamlUnknownKey.ReplaceAllString(msg, "unknown key $1")
+	}
+	return problems
+}
+
+// yamlLines finds lines in the node tree of a YAML file.
+type yamlLines struct {
+	root *yaml.Node
+}
+
+func (y yamlLines) line(section string, index int, key string) int {
+	node := y.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	sectionKey := mappingKey(node, section)
+	if sectionKey == nil {
+		return 0
+	}
+	node = node.Content[slices.Index(node.Content, sectionKey)+1]
+	if node.Kind == yaml.SequenceNode {
+		if index < 0 || index >= len(node.Content) {
+			return sectionKey.Line
+		}
+		node = node.Content[index]
+	}
+	if key == "" {
+		return node.Line
+	}
+	if k := mappingKey(node, key); k != nil {
+		return k.Line
+	}
+	return node.Line
+}
+
+// mappingKey returns the key node of a YAML mapping, nil if it has no such key.
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// decodeTOML decodes a TOML file, rejecting unknown keys.
+func decodeTOML(data []byte) (stateFile, stateLines, []StateProblem) {
+	var file stateFile
+	md, err := toml.Decode(string(data), &file)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return file, nil, []StateProblem{{Line: parseErr.Position.Line, Message: parseErr.Message}}
+		}
+		return file, nil, []StateProblem{{Message: err.Error()}}
+	}
+
+	lines := tomlLines(strings.Split(string(data), "\n"))
+	var problems []StateProblem
+	undecoded := md.Undecoded()
+	for _, key := range undecoded {
+		// An unknown table is reported once, not again for every key in it.
+		if len(key) > 1 && slices.ContainsFunc(undecoded, func(k toml.Key) bool { return k.String() == key[:len(key)-1].String() }) {
+			continue
+		}
+		problems = append(problems, StateProblem{Line: lines.keyLine(key), Message: "unknown key " + key.String()})
+	}
+	return file, lines, problems
+}
+
+// tomlLines finds lines by looking for the [table] and [[array]] headers in the
+// text of a TOML file, since the decoder doesn't tell where values came from.
+type tomlLines []string
+
+func (t tomlLines) line(section string, index int, key string) int {
+	line, _ := t.find(section, index, key)
+	return line
+}
+
+// find returns the line of a key, or of its entry if the key isn't written there.
+// It reports whether the key was found.
+func (t tomlLines) find(section string, index int, key string) (int, bool) {
+	header := "[" + section + "]"
+	if index >= 0 {
+		header = "[" + header + "]"
+	}
+	start := 0
+	for i, text := range t {
+		if !strings.HasPrefix(strings.TrimSpace(text), header) {
+			continue
+		}
+		if index <= 0 {
+			start = i + 1
+			break
+		}
+		index--
+	}
+	if start == 0 {
+		return 0, false
+	}
+	if key == "" {
+		return start, true
+	}
+	if line := t.keyAfter(start, key); line > 0 {
+		return line, true
+	}
+	return start, false
+}
+
+// keyAfter returns the line of a key between a header and the next one, 0 if it isn't there.
+func (t tomlLines) keyAfter(header int, key string) int {
+	for i := header; i < len(t); i++ {
+		text := strings.TrimSpace(t[i])
+		if strings.HasPrefix(text, "[") {
+			break
+		}
+		if name, _, ok := strings.Cut(text, "="); ok && strings.Trim(strings.TrimSpace(name), `"'`) == key {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// keyLine returns the line of a key the decoder reported, 0 if it can't be found.
+func (t tomlLines) keyLine(key toml.Key) int {
+	name := key[len(key)-1]
+	if len(key) == 1 {
+		// A key before the first header, or an unknown table.
+		if line := t.keyAfter(0, name); line > 0 {
+			return line
+		}
+		for _, index := range []int{-1, 0} {
+			if line, ok := t.find(name, index, ""); ok {
+				return line
+			}
+		}
+		return 0
+	}
+	section := key[0]
+	for index := 0; ; index++ {
+		line, ok := t.find(section, index, name)
+		if ok {
+			return line
+		}
+		if line == 0 {
+			break
+		}
+	}
+	return t.line(section, -1, name)
+}
@@ -0,0 +1,218 @@
+package routemanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wantProblem is a mistake LoadDesiredState must report: its line and part of its message.
+type wantProblem struct {
+	line int
+	text string
+}
+
+func TestLoadDesiredStateLines(t *testing.T) {
+	tests := []struct {
+		name string
+		file string // Its extension picks the format
+		data string
+		want []wantProblem
+	}{
+		{
+			name: "valid yaml",
+			file: "state.yaml",
+			data: `tables:
+  vpn: 100
+profiles:
+  office: mon-fri 09:00-18:00
+routes:
+  - destination: 10.0.0.0/8
+    via: 192.168.1.1
+    dev: eth1
+    tags: [office]
+rules:
+  - from: 192.168.1.0/24
+    table: vpn
+`,
+		},
+		{
+			name: "yaml syntax",
+			file: "state.yaml",
+			data: `routes:
+  - destination: 10.0.0.0/8
+    dev: "eth1
+`,
+			want: []wantProblem{{3, ""}},
+		},
+		{
+			name: "yaml unknown key",
+			file: "state.yaml",
+			data: `routes:
+  - destination: 10.0.0.0/8
+    dev: eth1
+    gatway: 192.168.1.1
+`,
+			want: []wantProblem{{4, "unknown key gatway"}},
+		},
+		{
+			name: "yaml wrong type",
+			file: "state.yaml",
+			data: `routes:
+  - destination: 10.0.0.0/8
+    dev: eth1
+    metric: high
+`,
+			want: []wantProblem{{4, "high"}},
+		},
+		{
+			name: "yaml every mistake with its line",
+			file: "state.yaml",
+			data: `profiles:
+  office: mon-fri 9-18
+routes:
+  - destination: 10.0.0.300/8
+    dev: eth1
+  - destination: 10.1.0.0/16
+    via: gateway
+    dev: eth1
+    active: someday 09:00-18:00
+  - destination: 10.2.0.0/16
+rules:
+  - from: 192.168.1.0/24
+    table: nosuchtable
+  - priority: 32766
+`,
+			want: []wantProblem{
+				{2, "profile office"},
+				{4, "10.0.0.300/8"},
+				{7, "invalid gateway"},
+				{9, "someday"},
+				{10, "without a dev"},
+				{13, "nosuchtable"},
+				{14, "default rules"},
+			},
+		},
+		{
+			name: "yaml duplicate route",
+			file: "state.yaml",
+			data: `routes:
+  - destination: 10.0.0.0/8
+    dev: eth1
+  - destination: 10.0.0.5/8
+    dev: eth1
+`,
+			want: []wantProblem{{4, "line 2"}},
+		},
+		{
+			name: "valid toml",
+			file: "state.toml",
+			data: `[tables]
+vpn = 100
+
+[profiles]
+office = "mon-fri 09:00-18:00"
+
+[[routes]]
+destination = "10.0.0.0/8"
+via = "192.168.1.1"
+dev = "eth1"
+tags = ["office"]
+
+[[rules]]
+from = "192.168.1.0/24"
+table = "vpn"
+`,
+		},
+		{
+			name: "toml syntax",
+			file: "state.toml",
+			data: `[[routes]]
+destination = "10.0.0.0/8"
+dev = eth1
+`,
+			want: []wantProblem{{3, ""}},
+		},
+		{
+			name: "toml unknown key",
+			file: "state.toml",
+			data: `[[routes]]
+destination = "10.0.0.0/8"
+dev = "eth1"
+
+[[routes]]
+destination = "10.1.0.0/16"
+dev = "eth1"
+gatway = "192.168.1.1"
+`,
+			want: []wantProblem{{8, "unknown key routes.gatway"}},
+		},
+		{
+			name: "toml every mistake with its line",
+			file: "state.toml",
+			data: `[profiles]
+office = "mon-fri 9-18"
+
+[[routes]]
+destination = "10.0.0.300/8"
+dev = "eth1"
+
+[[routes]]
+destination = "10.1.0.0/16"
+via = "gateway"
+dev = "eth1"
+active = "someday 09:00-18:00"
+
+[[routes]]
+destination = "10.2.0.0/16"
+
+[[rules]]
+from = "192.168.1.0/24"
+table = "nosuchtable"
+
+[[rules]]
+priority = 32766
+`,
+			want: []wantProblem{
+				{2, "profile office"},
+				{5, "10.0.0.300/8"},
+				{10, "invalid gateway"},
+				{12, "someday"},
+				{14, "without a dev"}, // Problems of a whole entry are on its header
+				{19, "nosuchtable"},
+				{21, "default rules"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadDesiredState(path)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var fileErr *StateFileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("error = %v, want a *StateFileError", err)
+			}
+			if len(fileErr.Problems) != len(tt.want) {
+				t.Fatalf("got %d problems, want %d:\n%v", len(fileErr.Problems), len(tt.want), err)
+			}
+			for i, want := range tt.want {
+				got := fileErr.Problems[i]
+				if got.Line != want.line || !strings.Contains(got.Message, want.text) {
+					t.Errorf("problem %d = line %d %q, want line %d containing %q", i, got.Line, got.Message, want.line, want.text)
+				}
+			}
+		})
+	}
+}
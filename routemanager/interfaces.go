@@ -0,0 +1,312 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Aliases are saved next to the routes, in a file of their own.
+const aliasesFile = "interface_aliases.json"
+
+// Interface names aren't stable: a USB dongle is enx<mac> on one laptop and eth1 on
+// another, and docks renumber interfaces. A saved route can therefore be bound to the
+// card instead of its name. StaticRoute.Bind holds one of
+//
+//	mac:<address>       the current hardware address
+//	permaddr:<address>  the permanent hardware address, which MAC randomization leaves alone
+//	alias:<name>        an alias from interface_aliases.json, or one set with `ip link set alias`
+//
+// and is resolved to the interface's current name whenever the route is applied.
+// Interface keeps the name the card had when the route was saved, for display.
+
+// BindMode is what a saved route uses to find its interface.
+type BindMode string
+
+const (
+	BindByName     BindMode = ""
+	BindByMAC      BindMode = "mac"
+	BindByPermAddr BindMode = "permaddr"
+	BindByAlias    BindMode = "alias"
+)
+
+// ErrInterfaceNotFound is returned when the interface of a route isn't there,
+// by name or by binding. Routes failing with it can wait for it, see AddOrQueue.
+var ErrInterfaceNotFound = errors.New("interface not found")
+
+// InterfaceAlias is a friendly name for a network card, e.g. "Office dock".
+// It follows the card by its hardware address, whatever the kernel calls it.
+type InterfaceAlias struct {
+	Alias   string `json:"alias"`
+	Address string `json:"address"` // Permanent hardware address, or the MAC if the card has none
+}
+
+// ParseBinding splits a binding into its mode and value. An empty binding
+// means the route uses the interface name.
+func ParseBinding(bind string) (BindMode, string) {
+	mode, value, ok := strings.Cut(bind, ":")
+	if !ok {
+		return BindByName, ""
+	}
+	return BindMode(mode), value
+}
+
+// BindingFor returns the binding that finds the interface named iface by mode.
+func BindingFor(iface string, mode BindMode) (string, error) {
+	if mode == BindByName {
+		return "", nil
+	}
+	h, err := handleFor(CurrentNamespace())
+	if err != nil {
+		return "", err
+	}
+	defer h.Close()
+
+	link, err := h.LinkByName(iface)
+	if err != nil {
+		return "", fmt.Errorf("interface %s not found: %w", iface, err)
+	}
+	attrs := link.Attrs()
+
+	var value string
+	switch mode {
+	case BindByMAC:
+		value = attrs.HardwareAddr.String()
+	case BindByPermAddr:
+		value = attrs.PermHWAddr.String()
+	case BindByAlias:
+		aliases, err := LoadInterfaceAliases()
+		if err != nil {
+			return "", err
+		}
+		value = aliasOf(link, aliases)
+	default:
+		return "", fmt.Errorf("unknown binding mode %q", mode)
+	}
+	if value == "" {
+		return "", fmt.Errorf("interface %s has no %s", iface, bindModeName(mode))
+	}
+	return string(mode) + ":" + value, nil
+}
+
+func bindModeName(mode BindMode) string {
+	switch mode {
+	case BindByMAC:
+		return "MAC address"
+	case BindByPermAddr:
+		return "permanent hardware address"
+	default:
+		return "alias"
+	}
+}
+
+// ResolveBindings returns a copy of routes in which every bound route carries
+// the current name of its interface. Matches compares names, so saved routes
+// must be resolved before they are compared against the live ones. Routes whose
+// interface isn't there right now keep the name they were saved with.
+func ResolveBindings(routes []StaticRoute) []StaticRoute {
+	resolved := slices.Clone(routes)
+	links := map[string][]netlink.Link{} // Per namespace, listed once
+	var aliases []InterfaceAlias
+	aliasesLoaded := false
+
+	for i, r := range resolved {
+		if r.Bind == "" || r.IsMultipath() || IsSpecialType(r.Type) {
+			continue
+		}
+		if _, ok := links[r.Namespace]; !ok {
+			links[r.Namespace] = listLinks(r.Namespace)
+		}
+		if !aliasesLoaded {
+			var err error
+			if aliases, err = LoadInterfaceAliases(); err != nil {
+				log.Printf("WARN: Could not load interface aliases: %v", err)
+			}
+			aliasesLoaded = true
+		}
+		if link := findBoundLink(links[r.Namespace], r.Bind, aliases); link != nil {
+			resolved[i].Interface = link.Attrs().Name
+		}
+	}
+	return resolved
+}
+
+// resolveLink finds the interface a route goes out of, by its binding if it has one.
+func resolveLink(h *netlink.Handle, route StaticRoute) (netlink.Link, error) {
+	if route.Bind == "" {
+		return linkByName(h, route.Interface)
+	}
+
+	links, err := h.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("could not list interfaces: %w", err)
+	}
+	aliases, err := LoadInterfaceAliases()
+	if err != nil {
+		return nil, err
+	}
+	link := findBoundLink(links, route.Bind, aliases)
+	if link == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInterfaceNotFound, route.Bind)
+	}
+	return link, nil
+}
+
+// linkByName is LinkByName, telling a missing interface apart from other failures.
+func linkByName(h *netlink.Handle, name string) (netlink.Link, error) {
+	link, err := h.LinkByName(name)
+	if errors.As(err, &netlink.LinkNotFoundError{}) {
+		return nil, fmt.Errorf("%w: %s", ErrInterfaceNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not look up interface %s: %w", name, err)
+	}
+	return link, nil
+}
+
+// findBoundLink returns the link a binding points at, or nil.
+func findBoundLink(links []netlink.Link, bind string, aliases []InterfaceAlias) netlink.Link {
+	mode, value := ParseBinding(bind)
+	for _, link := range links {
+		attrs := link.Attrs()
+		var match bool
+		switch mode {
+		case BindByMAC:
+			match = sameHardwareAddr(attrs.HardwareAddr, value)
+		case BindByPermAddr:
+			match = sameHardwareAddr(attrs.PermHWAddr, value)
+		case BindByAlias:
+			match = aliasOf(link, aliases) == value
+		}
+		if match {
+			return link
+		}
+	}
+	return nil
+}
+
+func sameHardwareAddr(addr net.HardwareAddr, text string) bool {
+	want, err := net.ParseMAC(text)
+	return err == nil && len(addr) > 0 && slices.Equal(addr, want)
+}
+
+// cardAddress is the address an alias follows: the permanent one if the card has it.
+func cardAddress(link netlink.Link) net.HardwareAddr {
+	if attrs := link.Attrs(); len(attrs.PermHWAddr) > 0 {
+		return attrs.PermHWAddr
+	}
+	return link.Attrs().HardwareAddr
+}
+
+// aliasOf returns the alias of a link: the one saved for its card, otherwise
+// the kernel's own alias, or "".
+func aliasOf(link netlink.Link, aliases []InterfaceAlias) string {
+	addr := cardAddress(link)
+	for _, a := range aliases {
+		if len(addr) > 0 && sameHardwareAddr(addr, a.Address) {
+			return a.Alias
+		}
+	}
+	return link.Attrs().Alias
+}
+
+func listLinks(namespace string) []netlink.Link {
+	h, err := handleFor(namespace)
+	if err != nil {
+		log.Printf("WARN: Could not list interfaces: %v", err)
+		return nil
+	}
+	defer h.Close()
+	links, err := h.LinkList()
+	if err != nil {
+		log.Printf("WARN: Could not list interfaces: %v", err)
+	}
+	return links
+}
+
+// InterfaceAliases maps the interfaces of the current namespace to their aliases.
+// Interfaces without an alias are left out.
+func InterfaceAliases() map[string]string {
+	aliases, err := LoadInterfaceAliases()
+	if err != nil {
+		log.Printf("WARN: Could not load interface aliases: %v", err)
+	}
+	names := map[string]string{}
+	for _, link := range listLinks(CurrentNamespace()) {
+		if alias := aliasOf(link, aliases); alias != "" {
+			names[link.Attrs().Name] = alias
+		}
+	}
+	return names
+}
+
+// SetInterfaceAlias gives the card behind iface a friendly name. An empty alias
+// removes it. Each alias names one card, so an alias taken by another card moves.
+func SetInterfaceAlias(iface, alias string) error {
+	alias = strings.TrimSpace(alias)
+	if strings.ContainsAny(alias, "()") {
+		return fmt.Errorf("invalid alias %q: parentheses are not allowed", alias)
+	}
+	h, err := handleFor(CurrentNamespace())
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	link, err := h.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("interface %s not found: %w", iface, err)
+	}
+	addr := cardAddress(link)
+	if len(addr) == 0 {
+		return fmt.Errorf("interface %s has no hardware address to follow", iface)
+	}
+
+	dir := StoreDir()
+	return withStoreLock(dir, func() error {
+		aliases, err := LoadInterfaceAliases()
+		if err != nil {
+			return err
+		}
+		aliases = slices.DeleteFunc(aliases, func(a InterfaceAlias) bool {
+			return a.Alias == alias || sameHardwareAddr(addr, a.Address)
+		})
+		if alias != "" {
+			aliases = append(aliases, InterfaceAlias{Alias: alias, Address: addr.String()})
+		}
+		return saveInterfaceAliases(aliases)
+	})
+}
+
+// saveInterfaceAliases overwrites interface_aliases.json with the given aliases.
+// The caller holds the store's lock.
+func saveInterfaceAliases(aliases []InterfaceAlias) error {
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFile(StoreDir(), aliasesFile, data)
+}
+
+// LoadInterfaceAliases reads the saved aliases. A missing file means none were given yet.
+func LoadInterfaceAliases() ([]InterfaceAlias, error) {
+	data, err := readStoreFile(StoreDir(), aliasesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []InterfaceAlias{}, nil
+		}
+		return nil, err
+	}
+
+	var aliases []InterfaceAlias
+	if err = json.Unmarshal(data, &aliases); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
@@ -1,15 +1,162 @@
 package routemanager
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MainTable is the ID of the kernel's main routing table, the one `ip route` shows.
+const MainTable = 254
+
 type StaticRoute struct {
+	// ID identifies a saved route in routes.json. It is empty for routes
+	// that only exist in the form or in the kernel.
+	ID          string `json:"id,omitempty"`
+	Type        string `json:"type,omitempty"` // One of RouteTypes, empty for unicast
 	Destination string `json:"destination"`
 	Interface   string `json:"interface"`
-	Gateway     string `json:"gateway"`
+	Bind        string `json:"bind,omitempty"`   // Finds Interface by MAC, permanent address or alias, see BindMode
+	Gateway     string `json:"gateway"`          // Empty for a device-only route
+	OnLink      bool   `json:"onlink,omitempty"` // Gateway is reachable on the link even outside its subnet
+	Metric      int    `json:"metric,omitempty"` // Route priority, lower wins. 0 lets the kernel decide
+	Src         string `json:"src,omitempty"`    // Preferred source address
+	Table       int    `json:"table,omitempty"`  // Routing table ID, 0 means "main"
+	Namespace   string `json:"netns,omitempty"`  // Network namespace, empty for the host's own
+	ReapplyOn   string `json:"tunnel,omitempty"` // Tunnel whose coming up re-applies the route, see WatchTunnels
+	PathAttributes
+
+	// NextHops makes this a multipath (ECMP) route. When set, Interface,
+	// Gateway and OnLink are ignored and every next hop carries its own.
+	NextHops []NextHop `json:"nexthops,omitempty"`
+
+	// Optional metadata. Older routes.json files don't have these fields,
+	// so every one of them must have a sensible zero value.
+	Description   string    `json:"description,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	Disabled      bool      `json:"disabled,omitempty"` // Zero value keeps old routes enabled
+	ActiveDuring  string    `json:"active,omitempty"`   // Activation windows, see ParseWindows
+	CreatedAt     time.Time `json:"created_at,omitzero"`
+	LastAppliedAt time.Time `json:"last_applied_at,omitzero"`
+
+	// Source is the store the route was loaded from, the user's or the system-wide one.
+	// It follows from the file the route is in, so it isn't saved.
+	Source StoreSource `json:"-"`
+}
+
+// PathAttributes tune TCP and the path MTU for connections using a route.
+// Zero values leave the kernel defaults in place.
+type PathAttributes struct {
+	MTU        int    `json:"mtu,omitempty"`
+	AdvMSS     int    `json:"advmss,omitempty"`   // MSS advertised to peers
+	InitCwnd   int    `json:"initcwnd,omitempty"` // Initial congestion window, in segments
+	InitRwnd   int    `json:"initrwnd,omitempty"` // Initial receive window, in segments
+	Congestion string `json:"congctl,omitempty"`  // TCP congestion control algorithm, e.g. "bbr"
+}
+
+// Summary formats the attributes that are set, in `ip route` syntax.
+func (p PathAttributes) Summary() string {
+	var parts []string
+	for _, attr := range []struct {
+		name  string
+		value int
+	}{{"mtu", p.MTU}, {"advmss", p.AdvMSS}, {"initcwnd", p.InitCwnd}, {"initrwnd", p.InitRwnd}} {
+		if attr.value != 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", attr.name, attr.value))
+		}
+	}
+	if p.Congestion != "" {
+		parts = append(parts, "congctl "+p.Congestion)
+	}
+	return strings.Join(parts, " ")
+}
+
+// IsMultipath reports whether the route balances traffic across several next hops.
+func (r StaticRoute) IsMultipath() bool {
+	return len(r.NextHops) > 0
+}
+
+// Enabled reports whether the saved route should be applied.
+func (r StaticRoute) Enabled() bool {
+	return !r.Disabled
+}
+
+// SameRoute reports whether two saved routes describe the same kernel route,
+// regardless of their IDs and metadata. Destinations must already be normalized.
+// Routes that differ only in metric or table are different routes.
+func (r StaticRoute) SameRoute(other StaticRoute) bool {
+	return r.Type == other.Type &&
+		r.Destination == other.Destination &&
+		r.Bind == other.Bind &&
+		(r.Bind != "" || r.Interface == other.Interface) &&
+		r.Gateway == other.Gateway &&
+		r.Metric == other.Metric &&
+		tableOrMain(r.Table) == tableOrMain(other.Table) &&
+		r.Namespace == other.Namespace &&
+		sameNextHops(r.NextHops, other.NextHops)
+}
+
+// Matches reports whether a live system route is the one described by this saved route.
+// A saved metric of 0 means "kernel default" and matches whatever metric the kernel chose.
+// Bound routes are compared by interface name, so resolve them with ResolveBindings first.
+func (r StaticRoute) Matches(s SystemRoute) bool {
+	return r.Type == s.Type &&
+		r.Destination == s.Destination &&
+		r.Interface == s.Interface &&
+		r.Gateway == s.Gateway &&
+		(r.Metric == 0 || r.Metric == s.Metric) &&
+		tableOrMain(r.Table) == tableOrMain(s.Table) &&
+		r.Namespace == s.Namespace &&
+		sameNextHops(r.NextHops, s.NextHops)
+}
+
+// String formats the route the way `ip route` prints it, which is also what it accepts.
+func (r StaticRoute) String() string {
+	var text string
+	if IsSpecialType(r.Type) {
+		text = r.Type + " " + r.Destination
+	} else if r.IsMultipath() {
+		text = r.Destination
+		for _, hop := range r.NextHops {
+			text += " " + hop.String()
+		}
+	} else {
+		text = r.Destination
+		if r.Gateway != "" {
+			text += " via " + r.Gateway
+		}
+		text += " dev " + r.Interface
+		if r.OnLink {
+			text += " onlink"
+		}
+	}
+	if r.Metric != 0 {
+		text += fmt.Sprintf(" metric %d", r.Metric)
+	}
+	if r.Src != "" {
+		text += " src " + r.Src
+	}
+	if r.Table != 0 && r.Table != MainTable {
+		text += " table " + TableName(r.Table)
+	}
+	if attrs := r.PathAttributes.Summary(); attrs != "" {
+		text += " " + attrs
+	}
+	return text
 }
 
 type SystemRoute struct {
-	Interface   string
+	Type        string // Empty for unicast, as in StaticRoute
+	Interface   string // Empty for blackhole and other special routes
 	Destination string
 	Gateway     string
-	Protocol    string // e.g., "static", "kernel", "dhcp"
-	IsStatic    bool   // A flag to easily identify deletable routes
+	OnLink      bool
+	NextHops    []NextHop // Set for multipath routes, which have no Interface or Gateway
+	Protocol    string    // e.g., "static", "kernel", "dhcp"
+	Metric      int
+	Src         string
+	Table       int // Kernel routing table ID, 254 is "main"
+	Namespace   string
+	IsStatic    bool // A flag to easily identify deletable routes
+	PathAttributes
 }
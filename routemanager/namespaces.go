@@ -0,0 +1,114 @@
+package routemanager
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// netnsDir is where `ip netns add` creates named network namespaces.
+const netnsDir = "/var/run/netns"
+
+// pidPrefix marks a namespace given by the PID of a process inside it, e.g. a container.
+const pidPrefix = "pid:"
+
+// A namespace is named the way the user picks it: "" is the host's own namespace,
+// "blue" is /var/run/netns/blue and "pid:4242" is the namespace process 4242 runs in.
+// PIDs change when a container restarts, so names are the better choice for saved routes.
+
+var (
+	namespaceMu      sync.RWMutex
+	currentNamespace string // Guarded by namespaceMu
+)
+
+// ListNamespaces returns the names of the namespaces under /var/run/netns.
+func ListNamespaces() []string {
+	entries, err := os.ReadDir(netnsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARN: Could not list network namespaces: %v", err)
+		}
+		return []string{}
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// CurrentNamespace returns the namespace that ListSystemRoutes, GetInterfaceNames
+// and ListRules work in. Everything that changes the system takes its namespace
+// from the route or rule instead.
+func CurrentNamespace() string {
+	namespaceMu.RLock()
+	defer namespaceMu.RUnlock()
+	return currentNamespace
+}
+
+// SetNamespace switches the namespace the listing functions work in.
+// It fails, and keeps the current one, if the namespace can't be opened.
+func SetNamespace(namespace string) error {
+	namespace = strings.TrimSpace(namespace)
+	h, err := handleFor(namespace)
+	if err != nil {
+		return err
+	}
+	h.Close()
+
+	namespaceMu.Lock()
+	currentNamespace = namespace
+	namespaceMu.Unlock()
+	ReloadTableNames() // VRFs are per namespace
+	return nil
+}
+
+// handleFor opens a netlink handle in the given namespace. The host's namespace
+// gets the package default handle, which needs no socket of its own.
+func handleFor(namespace string) (*netlink.Handle, error) {
+	if namespace == "" {
+		return &netlink.Handle{}, nil
+	}
+	ns, err := openNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	// The handle keeps its own reference to the namespace.
+	defer ns.Close()
+
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, fmt.Errorf("could not open netlink socket in namespace %s: %w", namespace, err)
+	}
+	return h, nil
+}
+
+// openNamespace resolves a namespace name or "pid:<pid>" to a namespace handle.
+func openNamespace(namespace string) (netns.NsHandle, error) {
+	if pidText, ok := strings.CutPrefix(namespace, pidPrefix); ok {
+		pid, err := strconv.Atoi(pidText)
+		if err != nil || pid <= 0 {
+			return netns.None(), fmt.Errorf("invalid namespace %q: expected pid:<number>", namespace)
+		}
+		ns, err := netns.GetFromPid(pid)
+		if err != nil {
+			return netns.None(), fmt.Errorf("could not open the network namespace of process %d: %w", pid, err)
+		}
+		return ns, nil
+	}
+
+	if namespace == "." || namespace == ".." || strings.Contains(namespace, "/") {
+		return netns.None(), fmt.Errorf("invalid namespace name %q", namespace)
+	}
+	ns, err := netns.GetFromName(namespace)
+	if err != nil {
+		return netns.None(), fmt.Errorf("could not open network namespace %s: %w", namespace, err)
+	}
+	return ns, nil
+}
@@ -3,24 +3,88 @@ package routemanager
 import (
 	"log"
 	"net"
+	"os"
+	"strings"
+
+	"github.com/vishvananda/netlink"
 )
 
+// GetInterfaceNames lists the interfaces of the current namespace, see SetNamespace.
 func GetInterfaceNames() []string {
-	interfaces, err := net.Interfaces()
+	h, err := handleFor(CurrentNamespace())
+	if err != nil {
+		log.Printf("Error getting network interfaces: %v", err)
+		return []string{}
+	}
+	defer h.Close()
+
+	links, err := h.LinkList()
 	if err != nil {
 		log.Printf("Error getting network interfaces: %v", err)
 		return []string{}
 	}
 
 	var names []string
-	for _, i := range interfaces {
+	for _, link := range links {
 		// Filter out loopback interfaces (like 'lo') and interfaces that are down.
-		isUp := i.Flags&net.FlagUp != 0
-		isLoopback := i.Flags&net.FlagLoopback != 0
+		attrs := link.Attrs()
+		isUp := attrs.Flags&net.FlagUp != 0
+		isLoopback := attrs.Flags&net.FlagLoopback != 0
 
 		if isUp && !isLoopback {
-			names = append(names, i.Name)
+			names = append(names, attrs.Name)
 		}
 	}
 	return names
 }
+
+// GetInterfaceAddresses returns the IP addresses assigned to an interface
+// of the current namespace.
+func GetInterfaceAddresses(name string) []string {
+	h, err := handleFor(CurrentNamespace())
+	if err != nil {
+		return []string{}
+	}
+	defer h.Close()
+
+	link, err := h.LinkByName(name)
+	if err != nil {
+		return []string{}
+	}
+	addrs, err := h.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		log.Printf("Error getting addresses of %s: %v", name, err)
+		return []string{}
+	}
+
+	var ips []string
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+	return ips
+}
+
+// InterfaceHasAddress reports whether ip is assigned to the interface. The
+// kernel only accepts a preferred source address that is local to the host.
+func InterfaceHasAddress(name, ip string) bool {
+	want := net.ParseIP(ip)
+	if want == nil {
+		return false
+	}
+	for _, addr := range GetInterfaceAddresses(name) {
+		if want.Equal(net.ParseIP(addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCongestionControls returns the TCP congestion control algorithms the kernel offers.
+func GetCongestionControls() []string {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/tcp_available_congestion_control")
+	if err != nil {
+		log.Printf("Error reading congestion control algorithms: %v", err)
+		return []string{}
+	}
+	return strings.Fields(string(data))
+}
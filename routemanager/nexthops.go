@@ -0,0 +1,107 @@
+package routemanager
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxWeight is the largest weight the kernel can store for a next hop.
+const maxWeight = 256
+
+// NextHop is one path of a multipath route. Traffic is balanced across the
+// next hops in proportion to their weights.
+type NextHop struct {
+	Gateway   string `json:"gateway,omitempty"`
+	Interface string `json:"interface"`
+	Weight    int    `json:"weight,omitempty"` // 0 and 1 both mean the default weight of 1
+	OnLink    bool   `json:"onlink,omitempty"`
+}
+
+// String formats the next hop the way `ip route` prints it.
+func (n NextHop) String() string {
+	text := "nexthop"
+	if n.Gateway != "" {
+		text += " via " + n.Gateway
+	}
+	text += " dev " + n.Interface
+	text += fmt.Sprintf(" weight %d", max(n.Weight, 1))
+	if n.OnLink {
+		text += " onlink"
+	}
+	return text
+}
+
+// checkWeight tells whether a weight fits the kernel. 0 stands for the default of 1,
+// so that next hops saved without a weight stay valid.
+func checkWeight(weight int) error {
+	if weight < 0 || weight > maxWeight {
+		return fmt.Errorf("weight %d must be between 1 and %d, or 0 for the default of 1", weight, maxWeight)
+	}
+	return nil
+}
+
+// sameNextHops compares next hops, treating weights 0 and 1 as equal.
+func sameNextHops(a, b []NextHop) bool {
+	return slices.EqualFunc(a, b, func(x, y NextHop) bool {
+		return x.Gateway == y.Gateway && x.Interface == y.Interface &&
+			max(x.Weight, 1) == max(y.Weight, 1)
+	})
+}
+
+// ParseNextHops reads next hops written one per line in `ip route` syntax,
+// e.g. "via 10.0.0.1 dev eth0 weight 2". The leading "nexthop" is optional.
+// Blank lines are skipped.
+func ParseNextHops(text string) ([]NextHop, error) {
+	var hops []NextHop
+	for n, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "nexthop" {
+			fields = fields[1:]
+		}
+
+		var hop NextHop
+		for i := 0; i < len(fields); i++ {
+			keyword := fields[i]
+			if keyword == "onlink" {
+				hop.OnLink = true
+				continue
+			}
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("line %d: %q needs a value", n+1, keyword)
+			}
+			i++
+			value := fields[i]
+			switch keyword {
+			case "via":
+				if net.ParseIP(value) == nil {
+					return nil, fmt.Errorf("line %d: invalid gateway IP %s", n+1, value)
+				}
+				hop.Gateway = value
+			case "dev":
+				hop.Interface = value
+			case "weight":
+				weight, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: weight %q is not a number", n+1, value)
+				}
+				if err := checkWeight(weight); err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+				hop.Weight = weight
+			default:
+				return nil, fmt.Errorf("line %d: unknown keyword %q", n+1, keyword)
+			}
+		}
+		if hop.Interface == "" {
+			return nil, fmt.Errorf("line %d: every next hop needs a dev", n+1)
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
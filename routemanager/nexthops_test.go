@@ -0,0 +1,44 @@
+package routemanager
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseNextHopsWeight(t *testing.T) {
+	tests := []struct {
+		line    string
+		weight  int
+		wantErr bool
+	}{
+		{"via 10.0.0.1 dev eth0", 0, false},
+		{"via 10.0.0.1 dev eth0 weight 0", 0, false},
+		{"via 10.0.0.1 dev eth0 weight 1", 1, false},
+		{"nexthop via 10.0.0.1 dev eth0 weight 256", 256, false},
+		{"via 10.0.0.1 dev eth0 weight 257", 0, true},
+		{"via 10.0.0.1 dev eth0 weight -1", 0, true},
+		{"via 10.0.0.1 dev eth0 weight heavy", 0, true},
+	}
+	for _, tt := range tests {
+		hops, err := ParseNextHops(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseNextHops(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if err == nil && hops[0].Weight != tt.weight {
+			t.Errorf("ParseNextHops(%q) weight = %d, want %d", tt.line, hops[0].Weight, tt.weight)
+		}
+	}
+}
+
+// The parser and Add must accept the same weights, so whatever the form or a
+// desired-state file lets through also reaches the kernel.
+func TestCheckWeightMatchesParser(t *testing.T) {
+	for weight := -2; weight <= maxWeight+2; weight++ {
+		_, parseErr := ParseNextHops(fmt.Sprintf("via 10.0.0.1 dev eth0 weight %d", weight))
+		checkErr := checkWeight(weight)
+		if (parseErr == nil) != (checkErr == nil) {
+			t.Errorf("weight %d: parser says %v, checkWeight says %v", weight, parseErr, checkErr)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// DefaultPendingExpiry is how long a route waits for its interface unless told otherwise.
+const DefaultPendingExpiry = 24 * time.Hour
+
+// The queue is kept in a file of its own, so routes keep waiting across restarts.
+const pendingFile = "pending_routes.json"
+
+// pendingRetryInterval also retries pending routes without a link event, which
+// covers namespaces that couldn't be watched and drops expired routes in time.
+const pendingRetryInterval = time.Minute
+
+// PendingRoute is a route waiting for its interface, e.g. a VPN tunnel that isn't
+// connected yet. The queue is saved with every change and read again by
+// WatchPendingRoutes, so a route keeps waiting when the program is restarted.
+type PendingRoute struct {
+	Route     StaticRoute `json:"route"`
+	QueuedAt  time.Time   `json:"queued_at"`
+	ExpiresAt time.Time   `json:"expires_at,omitzero"` // Zero means it waits until it is cancelled
+	LastError error       `json:"-"`                   // Why the last attempt failed after the interface came up, if it did
+}
+
+// Expired reports whether the route gave up waiting.
+func (p PendingRoute) Expired(now time.Time) bool {
+	return !p.ExpiresAt.IsZero() && now.After(p.ExpiresAt)
+}
+
+var (
+	pendingMu sync.Mutex
+	pending   []PendingRoute // Guarded by pendingMu
+
+	// pendingSaveMu keeps the queue file in the order of the changes. It is taken
+	// before pendingMu, and held across the write, which pendingMu never is.
+	pendingSaveMu sync.Mutex
+)
+
+// pendingWatch follows the interfaces of every namespace a route waits in, once
+// WatchPendingRoutes runs. Their events wake the watcher through pendingWake.
+var pendingWatch struct {
+	sync.Mutex
+	done    <-chan struct{}
+	watched map[string]bool // nil while no watcher runs
+}
+
+var pendingWake = make(chan struct{}, 1)
+
+// AddOrQueue is Add for routes whose interface may not exist yet. If it doesn't,
+// the route is queued and applied by ApplyPending once the interface is up and has
+// an address. expiry is how long it may wait, 0 for until it is cancelled.
+// It reports whether the route was queued instead of applied.
+func AddOrQueue(route StaticRoute, expiry time.Duration) (bool, error) {
+	err := Add(route)
+	if !errors.Is(err, ErrInterfaceNotFound) {
+		return false, err
+	}
+
+	now := time.Now()
+	p := PendingRoute{Route: route, QueuedAt: now}
+	if expiry > 0 {
+		p.ExpiresAt = now.Add(expiry)
+	}
+
+	pendingMu.Lock()
+	// Queuing a route again restarts its wait.
+	if i := indexOfPending(route); i >= 0 {
+		pending[i] = p
+	} else {
+		pending = append(pending, p)
+	}
+	pendingMu.Unlock()
+	log.Printf("Queued route %s until its interface appears", route)
+	savePending()
+	if err := watchPendingNamespace(route.Namespace); err != nil {
+		log.Printf("WARN: Route %s is only retried every %s: %v", route, pendingRetryInterval, err)
+	}
+	return true, nil
+}
+
+// PendingRoutes returns the routes waiting for their interface.
+func PendingRoutes() []PendingRoute {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	return slices.Clone(pending)
+}
+
+// PendingFor returns the queue entry of a route, if it is waiting.
+func PendingFor(route StaticRoute) (PendingRoute, bool) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if i := indexOfPending(route); i >= 0 {
+		return pending[i], true
+	}
+	return PendingRoute{}, false
+}
+
+// CancelPending takes a route off the queue. It reports whether it was waiting.
+func CancelPending(route StaticRoute) bool {
+	pendingMu.Lock()
+	i := indexOfPending(route)
+	if i >= 0 {
+		pending = slices.Delete(pending, i, i+1)
+	}
+	pendingMu.Unlock()
+	if i < 0 {
+		return false
+	}
+	savePending()
+	return true
+}
+
+// indexOfPending finds a queued route by saved ID, or else by what it describes,
+// since a route may be queued before it is saved. The caller holds pendingMu.
+func indexOfPending(route StaticRoute) int {
+	return slices.IndexFunc(pending, func(p PendingRoute) bool {
+		if route.ID != "" && p.Route.ID != "" {
+			return route.ID == p.Route.ID
+		}
+		return p.Route.SameRoute(route)
+	})
+}
+
+// ApplyPending applies the queued routes whose interface is ready and drops the
+// expired ones. It reports whether the queue changed. The routes are applied without
+// holding the queue, so the UI can list and cancel them meanwhile.
+func ApplyPending() bool {
+	// 1. TAKE A COPY OF THE QUEUE
+	pendingMu.Lock()
+	queued := slices.Clone(pending)
+	pendingMu.Unlock()
+
+	// 2. TRY THE ROUTES WHOSE INTERFACE IS READY
+	now := time.Now()
+	changed := false
+	var finished, failed []PendingRoute
+	for _, p := range queued {
+		if p.Expired(now) {
+			log.Printf("WARN: Gave up on route %s, its interface did not appear in time", p.Route)
+			finished = append(finished, p)
+			continue
+		}
+		if ready, err := interfaceReady(p.Route); err != nil || !ready {
+			continue
+		}
+		if err := Add(p.Route); err != nil {
+			// Right after the address arrives the gateway may not be reachable
+			// yet; keep trying until the route expires.
+			if p.LastError == nil || p.LastError.Error() != err.Error() {
+				log.Printf("WARN: Pending route %s could not be applied yet: %v", p.Route, err)
+				changed = true
+			}
+			p.LastError = err
+			failed = append(failed, p)
+			continue
+		}
+		log.Printf("Applied pending route %s", p.Route)
+		if err := MarkApplied(p.Route); err != nil {
+			log.Printf("WARN: Could not record when the route was applied: %v", err)
+		}
+		finished = append(finished, p)
+	}
+
+	// 3. RECORD THE OUTCOME. Routes that were cancelled or queued again in the
+	// meantime are left as they are now.
+	pendingMu.Lock()
+	sameEntry := func(p PendingRoute) int {
+		i := indexOfPending(p.Route)
+		if i >= 0 && !pending[i].QueuedAt.Equal(p.QueuedAt) {
+			return -1
+		}
+		return i
+	}
+	for _, p := range failed {
+		if i := sameEntry(p); i >= 0 {
+			pending[i].LastError = p.LastError
+		}
+	}
+	for _, p := range finished {
+		if i := sameEntry(p); i >= 0 {
+			pending = slices.Delete(pending, i, i+1)
+			changed = true
+		}
+	}
+	pendingMu.Unlock()
+
+	if len(finished) > 0 {
+		savePending()
+	}
+	return changed
+}
+
+// savePending writes the queue to pending_routes.json. A queue that can't be saved
+// still works until the program quits, so failures are only logged.
+func savePending() {
+	pendingSaveMu.Lock()
+	defer pendingSaveMu.Unlock()
+	pendingMu.Lock()
+	queued := slices.Clone(pending)
+	pendingMu.Unlock()
+	if queued == nil {
+		queued = []PendingRoute{}
+	}
+
+	data, err := json.MarshalIndent(queued, "", "  ")
+	if err == nil {
+		dir := StoreDir()
+		err = withStoreLock(dir, func() error { return writeStoreFile(dir, pendingFile, data) })
+	}
+	if err != nil {
+		log.Printf("WARN: Pending routes won't survive a restart: %v", err)
+	}
+}
+
+// loadPending puts the routes of pending_routes.json back on the queue, next to
+// any queued since the program started.
+func loadPending() error {
+	data, err := readStoreFile(StoreDir(), pendingFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var saved []PendingRoute
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s: %w", pendingFile, err)
+	}
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	for _, p := range saved {
+		if indexOfPending(p.Route) < 0 {
+			pending = append(pending, p)
+		}
+	}
+	return nil
+}
+
+// interfaceReady reports whether every interface of a route exists, is up and has an address.
+func interfaceReady(route StaticRoute) (bool, error) {
+	if IsSpecialType(route.Type) {
+		return true, nil
+	}
+	h, err := handleFor(route.Namespace)
+	if err != nil {
+		return false, err
+	}
+	defer h.Close()
+
+	var links []netlink.Link
+	if route.IsMultipath() {
+		for _, hop := range route.NextHops {
+			link, err := linkByName(h, hop.Interface)
+			if err != nil {
+				return false, err
+			}
+			links = append(links, link)
+		}
+	} else {
+		link, err := resolveLink(h, route)
+		if err != nil {
+			return false, err
+		}
+		links = append(links, link)
+	}
+
+	for _, link := range links {
+		if link.Attrs().Flags&net.FlagUp == 0 {
+			return false, nil
+		}
+		addrs, err := h.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return false, fmt.Errorf("could not list addresses of %s: %w", link.Attrs().Name, err)
+		}
+		if len(addrs) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// WatchPendingRoutes applies queued routes as soon as their interface comes up and
+// gets an address, until done is closed. onChange is called whenever a route was
+// applied or dropped. Routes still waiting from the last run are queued again first.
+// It follows the host and every namespace a route waits in, including routes queued later.
+func WatchPendingRoutes(done <-chan struct{}, onChange func()) error {
+	if err := loadPending(); err != nil {
+		log.Printf("WARN: Could not restore the pending routes: %v", err)
+	}
+	pendingWatch.Lock()
+	pendingWatch.done, pendingWatch.watched = done, map[string]bool{}
+	pendingWatch.Unlock()
+
+	if err := watchPendingNamespace(""); err != nil {
+		return err
+	}
+	for _, p := range PendingRoutes() {
+		if err := watchPendingNamespace(p.Route.Namespace); err != nil {
+			log.Printf("WARN: Route %s is only retried every %s: %v", p.Route, pendingRetryInterval, err)
+		}
+	}
+
+	go func() {
+		// Restored routes whose interface came up while the program wasn't running.
+		if ApplyPending() && onChange != nil {
+			onChange()
+		}
+		ticker := time.NewTicker(pendingRetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-pendingWake:
+			case <-ticker.C:
+			}
+			if ApplyPending() && onChange != nil {
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+// watchPendingNamespace has the running watcher follow the interfaces of a namespace.
+// Without a running watcher, or when it follows the namespace already, it does nothing.
+func watchPendingNamespace(namespace string) error {
+	pendingWatch.Lock()
+	defer pendingWatch.Unlock()
+	if pendingWatch.watched == nil || pendingWatch.watched[namespace] {
+		return nil
+	}
+
+	// The subscriptions keep their sockets in the namespace, the handle isn't needed after.
+	ns := netns.None()
+	if namespace != "" {
+		var err error
+		if ns, err = openNamespace(namespace); err != nil {
+			return err
+		}
+		defer ns.Close()
+	}
+	done := pendingWatch.done
+	links := make(chan netlink.LinkUpdate)
+	if err := netlink.LinkSubscribeWithOptions(links, done, netlink.LinkSubscribeOptions{Namespace: &ns}); err != nil {
+		return fmt.Errorf("could not watch interfaces: %w", err)
+	}
+	addrs := make(chan netlink.AddrUpdate)
+	if err := netlink.AddrSubscribeWithOptions(addrs, done, netlink.AddrSubscribeOptions{Namespace: &ns}); err != nil {
+		return fmt.Errorf("could not watch interface addresses: %w", err)
+	}
+	pendingWatch.watched[namespace] = true
+
+	go func() {
+		for links != nil || addrs != nil {
+			select {
+			case <-done:
+				return
+			case _, ok := <-links:
+				if !ok {
+					links = nil // Closed, keep going on the other events
+					continue
+				}
+			case _, ok := <-addrs:
+				if !ok {
+					addrs = nil
+					continue
+				}
+			}
+			select {
+			case pendingWake <- struct{}{}:
+			default: // A wake-up is already on its way
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,138 @@
+package routemanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// withTestQueue empties the queue of pending routes for the test, in a store of its own.
+func withTestQueue(t *testing.T) {
+	t.Helper()
+	inTestStore(t)
+	pendingMu.Lock()
+	queued := pending
+	pending = nil
+	pendingMu.Unlock()
+	t.Cleanup(func() {
+		pendingMu.Lock()
+		pending = queued
+		pendingMu.Unlock()
+	})
+}
+
+// waitingRoute is a route for an interface that doesn't exist.
+func waitingRoute(destination string) StaticRoute {
+	return StaticRoute{Destination: destination, Interface: "nosuchif0"}
+}
+
+func TestPendingRoutesSurviveRestart(t *testing.T) {
+	withTestQueue(t)
+	queued, err := AddOrQueue(waitingRoute("10.0.0.0/24"), time.Hour)
+	if err != nil || !queued {
+		t.Fatalf("AddOrQueue = %v, %v, want true, nil", queued, err)
+	}
+	if _, err := AddOrQueue(waitingRoute("10.1.0.0/24"), 0); err != nil {
+		t.Fatal(err)
+	}
+	want := PendingRoutes()
+
+	// A restart starts with an empty queue and reads it back from the store.
+	pendingMu.Lock()
+	pending = nil
+	pendingMu.Unlock()
+	if err := loadPending(); err != nil {
+		t.Fatal(err)
+	}
+	got := PendingRoutes()
+	if len(got) != len(want) {
+		t.Fatalf("restored %d routes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Route.String() != want[i].Route.String() ||
+			!got[i].QueuedAt.Equal(want[i].QueuedAt) || !got[i].ExpiresAt.Equal(want[i].ExpiresAt) {
+			t.Errorf("restored %+v, want %+v", got[i], want[i])
+		}
+	}
+	if !got[1].ExpiresAt.IsZero() {
+		t.Errorf("a route without expiry expires at %s", got[1].ExpiresAt)
+	}
+
+	// Loading again doesn't queue them twice, and a cancelled route stays cancelled.
+	if err := loadPending(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(PendingRoutes()); n != 2 {
+		t.Errorf("%d routes after loading twice, want 2", n)
+	}
+	if !CancelPending(waitingRoute("10.0.0.0/24")) {
+		t.Fatal("CancelPending found no route")
+	}
+	pendingMu.Lock()
+	pending = nil
+	pendingMu.Unlock()
+	if err := loadPending(); err != nil {
+		t.Fatal(err)
+	}
+	if got := PendingRoutes(); len(got) != 1 || got[0].Route.Destination != "10.1.0.0/24" {
+		t.Errorf("restored %+v after cancelling, want only 10.1.0.0/24", got)
+	}
+}
+
+func TestApplyPendingDropsExpiredRoutes(t *testing.T) {
+	withTestQueue(t)
+	now := time.Now()
+	pendingMu.Lock()
+	pending = []PendingRoute{
+		{Route: waitingRoute("10.0.0.0/24"), QueuedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		{Route: waitingRoute("10.1.0.0/24"), QueuedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Route: waitingRoute("10.2.0.0/24"), QueuedAt: now.Add(-48 * time.Hour)},
+	}
+	pendingMu.Unlock()
+
+	if !ApplyPending() {
+		t.Error("ApplyPending reported no change after dropping a route")
+	}
+	got := PendingRoutes()
+	if len(got) != 2 || got[0].Route.Destination != "10.1.0.0/24" || got[1].Route.Destination != "10.2.0.0/24" {
+		t.Errorf("left %+v, want the routes that are still waiting", got)
+	}
+
+	// The queue in the store has lost it too.
+	pendingMu.Lock()
+	pending = nil
+	pendingMu.Unlock()
+	if err := loadPending(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(PendingRoutes()); n != 2 {
+		t.Errorf("the store has %d pending routes, want 2", n)
+	}
+	if ApplyPending() {
+		t.Error("ApplyPending reported a change with nothing to do")
+	}
+}
+
+func TestAddOrQueueRestartsWait(t *testing.T) {
+	withTestQueue(t)
+	route := waitingRoute("10.0.0.0/24")
+	if _, err := AddOrQueue(route, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := PendingFor(route)
+	if _, err := AddOrQueue(route, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	again, ok := PendingFor(route)
+	if !ok || len(PendingRoutes()) != 1 {
+		t.Fatalf("queued %+v, want the route once", PendingRoutes())
+	}
+	if !again.ExpiresAt.After(first.ExpiresAt.Add(30 * time.Minute)) {
+		t.Errorf("expires at %s after queuing again, was %s", again.ExpiresAt, first.ExpiresAt)
+	}
+
+	// A route whose interface exists but fails otherwise isn't queued.
+	if _, err := AddOrQueue(StaticRoute{Destination: "bad", Interface: "lo"}, time.Hour); err == nil || errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("AddOrQueue of an invalid route: %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// What was applied from desired-state files is recorded, so pruning only ever
+// removes what an earlier apply put there, never routes set up by hand or by DHCP.
+const managedFile = "managed_state.json"
+
+// managedState lists the routes and rules applied from desired-state files. The
+// profiles of the files are kept with them, so WatchActivation can turn the routes
+// on and off in their windows.
+type managedState struct {
+	Routes   []StaticRoute `json:"routes"`
+	Rules    []Rule        `json:"rules"`
+	Profiles []Profile     `json:"profiles,omitempty"`
+}
+
+// ChangeKind is what a plan does to a route or rule.
+type ChangeKind int
+
+const (
+	ChangeAdd     ChangeKind = iota
+	ChangeReplace            // A live route goes somewhere else or has other attributes
+	ChangeRemove
+)
+
+// Symbol marks the change in a plan, the way diffs do.
+func (k ChangeKind) Symbol() string {
+	switch k {
+	case ChangeReplace:
+		return "~"
+	case ChangeRemove:
+		return "-"
+	default:
+		return "+"
+	}
+}
+
+// RouteChange is one route a plan adds, replaces or removes.
+type RouteChange struct {
+	Kind  ChangeKind
+	Route StaticRoute
+	Old   StaticRoute // The live route being replaced
+}
+
+// RuleChange is one rule a plan adds or removes.
+type RuleChange struct {
+	Kind ChangeKind
+	Rule Rule
+}
+
+// Plan is what ApplyPlan does to bring the system to a desired state.
+type Plan struct {
+	Routes []RouteChange
+	Rules  []RuleChange
+
+	managed managedState // What is managed once the plan is applied
+	read    managedState // What was managed when the plan was made
+}
+
+// Empty reports whether the system already is in the desired state.
+func (p Plan) Empty() bool {
+	return len(p.Routes) == 0 && len(p.Rules) == 0
+}
+
+// String lists the changes one per line, followed by a count of them.
+func (p Plan) String() string {
+	var lines []string
+	counts := map[ChangeKind]int{}
+	for _, c := range p.Routes {
+		text := fmt.Sprintf("%s route %s", c.Kind.Symbol(), c.Route)
+		if c.Route.Namespace != "" {
+			text += " netns " + c.Route.Namespace
+		}
+		if c.Kind == ChangeReplace {
+			text += fmt.Sprintf(" (now %s)", c.Old)
+		}
+		lines = append(lines, text)
+		counts[c.Kind]++
+	}
+	for _, c := range p.Rules {
+		text := fmt.Sprintf("%s rule %s", c.Kind.Symbol(), c.Rule)
+		if c.Rule.Namespace != "" {
+			text += " netns " + c.Rule.Namespace
+		}
+		lines = append(lines, text)
+		counts[c.Kind]++
+	}
+	lines = append(lines, fmt.Sprintf("%d to add, %d to change, %d to remove.",
+		counts[ChangeAdd], counts[ChangeReplace], counts[ChangeRemove]))
+	return strings.Join(lines, "\n")
+}
+
+// PlanState compares a desired state with the live routes and rules. Routes with
+// activation windows are planned for now: outside their windows they are removed.
+// Once applied, WatchActivation turns them on and off as their windows come and go.
+// With prune, managed routes and rules that are no longer in the file are removed too;
+// without it they are left in place and stay managed for a later prune.
+func PlanState(state DesiredState, prune bool, now time.Time) (Plan, error) {
+	managed, err := loadManagedState()
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{read: managed}
+	live := map[string][]SystemRoute{}
+	liveIn := func(namespace string) []SystemRoute {
+		if _, ok := live[namespace]; !ok {
+			live[namespace] = ListSystemRoutesIn(namespace)
+		}
+		return live[namespace]
+	}
+
+	// 1. ROUTES IN THE FILE
+	for _, route := range state.Routes {
+		windows, err := RouteWindows(route, state.Profiles)
+		if err != nil {
+			return Plan{}, fmt.Errorf("%s: %w", route, err)
+		}
+		wanted := route.Enabled() && (len(windows) == 0 || ActiveAt(windows, now))
+		routes := liveIn(route.Namespace)
+		i := slices.IndexFunc(routes, route.Matches)
+
+		switch {
+		case !wanted:
+			if i >= 0 {
+				plan.Routes = append(plan.Routes, RouteChange{Kind: ChangeRemove, Route: route})
+			}
+		case i >= 0:
+			if s := routes[i]; s.Src != route.Src || s.OnLink != route.OnLink || s.PathAttributes != route.PathAttributes {
+				plan.Routes = append(plan.Routes, RouteChange{Kind: ChangeReplace, Route: route, Old: liveToStatic(s)})
+			}
+		default:
+			// A live route with the same destination, metric and table is overwritten.
+			j := slices.IndexFunc(routes, func(s SystemRoute) bool { return sameKernelRoute(route, liveToStatic(s)) })
+			if j >= 0 {
+				plan.Routes = append(plan.Routes, RouteChange{Kind: ChangeReplace, Route: route, Old: liveToStatic(routes[j])})
+			} else {
+				plan.Routes = append(plan.Routes, RouteChange{Kind: ChangeAdd, Route: route})
+			}
+		}
+	}
+	plan.managed.Routes = slices.Clone(state.Routes)
+	// Managed routes kept without prune may still use profiles the file dropped.
+	plan.managed.Profiles = slices.Clone(state.Profiles)
+	for _, p := range managed.Profiles {
+		if !slices.ContainsFunc(plan.managed.Profiles, func(q Profile) bool { return q.Name == p.Name }) {
+			plan.managed.Profiles = append(plan.managed.Profiles, p)
+		}
+	}
+
+	// 2. MANAGED ROUTES THAT LEFT THE FILE
+	for _, route := range managed.Routes {
+		if slices.ContainsFunc(state.Routes, route.SameRoute) {
+			continue
+		}
+		isLive := slices.ContainsFunc(liveIn(route.Namespace), route.Matches)
+		switch {
+		case prune && isLive:
+			plan.Routes = append(plan.Routes, RouteChange{Kind: ChangeRemove, Route: route})
+		case !prune:
+			plan.managed.Routes = append(plan.managed.Routes, route)
+		}
+	}
+
+	// 3. RULES
+	liveRules := map[string][]SystemRule{}
+	rulesIn := func(namespace string) ([]SystemRule, error) {
+		if _, ok := liveRules[namespace]; !ok {
+			rules, err := ListRulesIn(namespace)
+			if err != nil {
+				return nil, err
+			}
+			liveRules[namespace] = rules
+		}
+		return liveRules[namespace], nil
+	}
+	for _, rule := range state.Rules {
+		rules, err := rulesIn(rule.Namespace)
+		if err != nil {
+			return Plan{}, err
+		}
+		if !slices.ContainsFunc(rules, rule.Matches) {
+			plan.Rules = append(plan.Rules, RuleChange{Kind: ChangeAdd, Rule: rule})
+		}
+	}
+	plan.managed.Rules = slices.Clone(state.Rules)
+	for _, rule := range managed.Rules {
+		if slices.ContainsFunc(state.Rules, rule.SameRule) {
+			continue
+		}
+		rules, err := rulesIn(rule.Namespace)
+		if err != nil {
+			return Plan{}, err
+		}
+		isLive := slices.ContainsFunc(rules, rule.Matches)
+		switch {
+		case prune && isLive:
+			plan.Rules = append(plan.Rules, RuleChange{Kind: ChangeRemove, Rule: rule})
+		case !prune:
+			plan.managed.Rules = append(plan.managed.Rules, rule)
+		}
+	}
+	return plan, nil
+}
+
+// ApplyPlan carries out a plan and records what is managed from now on. It goes on
+// after a failed change and returns all failures together. New routes go in before
+// old ones come out, so traffic moving between them always has one.
+func ApplyPlan(plan Plan) error {
+	var errs []error
+	managed := plan.managed
+
+	// 1. ADD AND REPLACE
+	for _, c := range plan.Routes {
+		var err error
+		switch c.Kind {
+		case ChangeAdd:
+			err = Add(c.Route)
+		case ChangeReplace:
+			err = Replace(c.Old, c.Route)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Route, err))
+		}
+	}
+	for _, c := range plan.Rules {
+		if c.Kind != ChangeAdd {
+			continue
+		}
+		if err := EnsureRule(c.Rule); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", c.Rule, err))
+		}
+	}
+
+	// 2. REMOVE
+	for _, c := range plan.Rules {
+		if c.Kind != ChangeRemove {
+			continue
+		}
+		if _, err := DeleteMatchingRules(c.Rule); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", c.Rule, err))
+			// Still there, so a later prune should try again.
+			if !slices.ContainsFunc(managed.Rules, c.Rule.SameRule) {
+				managed.Rules = append(managed.Rules, c.Rule)
+			}
+		}
+	}
+	for _, c := range plan.Routes {
+		if c.Kind != ChangeRemove {
+			continue
+		}
+		if err := Delete(c.Route); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Route, err))
+			if !slices.ContainsFunc(managed.Routes, c.Route.SameRoute) {
+				managed.Routes = append(managed.Routes, c.Route)
+			}
+		}
+	}
+
+	// 3. RECORD WHAT IS MANAGED. Another apply may have recorded routes and rules since
+	// the plan was made; they stay managed, so a later prune still knows about them.
+	dir := StoreDir()
+	err := withStoreLock(dir, func() error {
+		current, err := loadManagedState()
+		if err != nil {
+			return err
+		}
+		return saveManagedState(mergeManaged(managed, current, plan.read))
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not record the managed routes: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// mergeManaged adds to what a plan manages what others recorded in current since read.
+func mergeManaged(planned, current, read managedState) managedState {
+	merged := managedState{
+		Routes:   slices.Clone(planned.Routes),
+		Rules:    slices.Clone(planned.Rules),
+		Profiles: slices.Clone(planned.Profiles),
+	}
+	for _, route := range current.Routes {
+		if !slices.ContainsFunc(read.Routes, route.SameRoute) && !slices.ContainsFunc(merged.Routes, route.SameRoute) {
+			merged.Routes = append(merged.Routes, route)
+		}
+	}
+	for _, rule := range current.Rules {
+		if !slices.ContainsFunc(read.Rules, rule.SameRule) && !slices.ContainsFunc(merged.Rules, rule.SameRule) {
+			merged.Rules = append(merged.Rules, rule)
+		}
+	}
+	sameName := func(name string) func(Profile) bool {
+		return func(p Profile) bool { return p.Name == name }
+	}
+	for _, p := range current.Profiles {
+		if !slices.ContainsFunc(read.Profiles, sameName(p.Name)) && !slices.ContainsFunc(merged.Profiles, sameName(p.Name)) {
+			merged.Profiles = append(merged.Profiles, p)
+		}
+	}
+	return merged
+}
+
+// liveToStatic describes a live route the way the routes of a desired state are described.
+func liveToStatic(s SystemRoute) StaticRoute {
+	table := s.Table
+	if table == MainTable {
+		table = 0
+	}
+	return StaticRoute{
+		Type:           s.Type,
+		NextHops:       s.NextHops,
+		Interface:      s.Interface,
+		Destination:    s.Destination,
+		Gateway:        s.Gateway,
+		OnLink:         s.OnLink,
+		Metric:         s.Metric,
+		Src:            s.Src,
+		Table:          table,
+		Namespace:      s.Namespace,
+		PathAttributes: s.PathAttributes,
+	}
+}
+
+// saveManagedState overwrites managed_state.json. The caller holds the store's lock.
+func saveManagedState(managed managedState) error {
+	data, err := json.MarshalIndent(managed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFile(StoreDir(), managedFile, data)
+}
+
+// loadManagedState reads what was applied from desired-state files. A missing file means nothing was.
+func loadManagedState() (managedState, error) {
+	data, err := readStoreFile(StoreDir(), managedFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return managedState{}, nil
+		}
+		return managedState{}, err
+	}
+
+	var managed managedState
+	if err = json.Unmarshal(data, &managed); err != nil {
+		return managedState{}, err
+	}
+	return managed, nil
+}
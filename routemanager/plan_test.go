@@ -0,0 +1,46 @@
+package routemanager
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeManaged(t *testing.T) {
+	route := func(destination string) StaticRoute {
+		return StaticRoute{Destination: destination, Interface: "eth0"}
+	}
+	rule := func(from string) Rule { return Rule{From: from, Table: 100} }
+
+	read := managedState{
+		Routes:   []StaticRoute{route("10.0.0.0/24"), route("10.1.0.0/24")},
+		Rules:    []Rule{rule("192.168.1.0/24")},
+		Profiles: []Profile{{Name: "office", ActiveDuring: "mon-fri 09:00-18:00"}},
+	}
+	// The plan pruned 10.1.0.0/24 and added 10.2.0.0/24.
+	planned := managedState{
+		Routes:   []StaticRoute{route("10.0.0.0/24"), route("10.2.0.0/24")},
+		Rules:    []Rule{rule("192.168.1.0/24")},
+		Profiles: []Profile{{Name: "office", ActiveDuring: "mon-fri 08:00-17:00"}},
+	}
+	// Meanwhile another apply recorded 10.3.0.0/24, a rule and a profile of its own.
+	current := managedState{
+		Routes:   append(slices.Clone(read.Routes), route("10.3.0.0/24")),
+		Rules:    append(slices.Clone(read.Rules), rule("192.168.2.0/24")),
+		Profiles: append(slices.Clone(read.Profiles), Profile{Name: "lab", ActiveDuring: "* 20:00-22:00"}),
+	}
+
+	got := mergeManaged(planned, current, read)
+	var routes []string
+	for _, r := range got.Routes {
+		routes = append(routes, r.Destination)
+	}
+	if want := []string{"10.0.0.0/24", "10.2.0.0/24", "10.3.0.0/24"}; !slices.Equal(routes, want) {
+		t.Errorf("routes %q, want %q", routes, want)
+	}
+	if len(got.Rules) != 2 || got.Rules[1].From != "192.168.2.0/24" {
+		t.Errorf("rules %+v, want the planned one and the other apply's", got.Rules)
+	}
+	if len(got.Profiles) != 2 || got.Profiles[0].ActiveDuring != "mon-fri 08:00-17:00" || got.Profiles[1].Name != "lab" {
+		t.Errorf("profiles %+v, want the planned office and the other apply's lab", got.Profiles)
+	}
+}
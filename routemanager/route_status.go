@@ -0,0 +1,41 @@
+package routemanager
+
+// RouteState describes how a saved route relates to the kernel routing table.
+type RouteState int
+
+const (
+	StateAbsent  RouteState = iota // No live route to this destination
+	StateActive                    // The live route matches the saved one
+	StateDrifted                   // A live route to the same destination goes somewhere else
+	StatePending                   // Waiting for its interface to appear, see AddOrQueue
+)
+
+func (s RouteState) String() string {
+	switch s {
+	case StateActive:
+		return "active"
+	case StateDrifted:
+		return "drifted"
+	case StatePending:
+		return "pending"
+	default:
+		return "absent"
+	}
+}
+
+// SavedRouteState compares a saved route against the live routes from ListSystemRoutes.
+func SavedRouteState(route StaticRoute, live []SystemRoute) RouteState {
+	state := StateAbsent
+	for _, s := range live {
+		if route.Matches(s) {
+			return StateActive
+		}
+		if route.Destination == s.Destination {
+			state = StateDrifted
+		}
+	}
+	if _, ok := PendingFor(route); ok {
+		return StatePending
+	}
+	return state
+}
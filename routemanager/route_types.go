@@ -0,0 +1,64 @@
+package routemanager
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Route types a StaticRoute can have. The empty string is a regular
+// unicast route that forwards traffic through an interface.
+const (
+	TypeUnicast     = ""
+	TypeBlackhole   = "blackhole"   // Silently drop the traffic
+	TypeUnreachable = "unreachable" // Drop and answer with ICMP host unreachable
+	TypeProhibit    = "prohibit"    // Drop and answer with ICMP administratively prohibited
+	TypeThrow       = "throw"       // Stop the lookup in this table and continue with the next rule
+)
+
+// RouteTypes lists the route types that can be created, unicast first.
+var RouteTypes = []string{TypeUnicast, TypeBlackhole, TypeUnreachable, TypeProhibit, TypeThrow}
+
+var kernelRouteTypes = map[string]int{
+	TypeUnicast:     unix.RTN_UNICAST,
+	TypeBlackhole:   unix.RTN_BLACKHOLE,
+	TypeUnreachable: unix.RTN_UNREACHABLE,
+	TypeProhibit:    unix.RTN_PROHIBIT,
+	TypeThrow:       unix.RTN_THROW,
+}
+
+// IsSpecialType reports whether routes of this type have no interface or gateway.
+func IsSpecialType(routeType string) bool {
+	return routeType != TypeUnicast
+}
+
+// kernelRouteType converts one of our route types into the kernel's RTN_* value.
+func kernelRouteType(routeType string) (int, error) {
+	t, ok := kernelRouteTypes[routeType]
+	if !ok {
+		return 0, fmt.Errorf("unknown route type %q", routeType)
+	}
+	return t, nil
+}
+
+// routeTypeName converts the kernel's RTN_* value into a name, as `ip route` shows it.
+func routeTypeName(t int) string {
+	for name, kernelType := range kernelRouteTypes {
+		if kernelType == t {
+			return name
+		}
+	}
+	switch t {
+	case unix.RTN_LOCAL:
+		return "local"
+	case unix.RTN_BROADCAST:
+		return "broadcast"
+	case unix.RTN_ANYCAST:
+		return "anycast"
+	case unix.RTN_MULTICAST:
+		return "multicast"
+	case unix.RTN_NAT:
+		return "nat"
+	}
+	return fmt.Sprintf("type %d", t)
+}
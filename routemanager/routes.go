@@ -12,58 +12,216 @@ import (
 // It uses RouteReplace which acts as an "upsert" (update or insert),
 // making it safer than RouteAdd as it won't fail if the route already exists.
 func Add(route StaticRoute) error {
-	link, err := netlink.LinkByName(route.Interface)
+	h, err := handleFor(route.Namespace)
 	if err != nil {
-		return fmt.Errorf("interface %s not found: %w", route.Interface, err)
+		return err
 	}
+	defer h.Close()
+	return addWith(h, route)
+}
 
-	_, dst, err := net.ParseCIDR(route.Destination)
+// Delete removes a static route from the system's routing table.
+func Delete(route StaticRoute) error {
+	h, err := handleFor(route.Namespace)
 	if err != nil {
-		return fmt.Errorf("invalid destination CIDR %s: %w", route.Destination, err)
+		return err
 	}
+	defer h.Close()
+	return deleteWith(h, route)
+}
 
-	gw := net.ParseIP(route.Gateway)
-	if gw == nil {
-		return fmt.Errorf("invalid gateway IP %s", route.Gateway)
+// Replace changes an existing route into updated without a window where neither exists.
+// When the kernel sees both as the same route (same destination, metric and table)
+// this is a single atomic RouteReplace. Otherwise the new route is installed first
+// and the old one is removed afterwards.
+func Replace(old, updated StaticRoute) error {
+	if old.Namespace != updated.Namespace {
+		return errors.New("a route can't be moved to another namespace, add it there instead")
 	}
+	h, err := handleFor(updated.Namespace)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
 
-	routeObj := &netlink.Route{
-		LinkIndex: link.Attrs().Index,
-		Dst:       dst,
-		Gw:        gw,
+	if err := addWith(h, updated); err != nil {
+		return err
+	}
+	if sameKernelRoute(old, updated) {
+		return nil
 	}
+	if err := deleteWith(h, old); err != nil {
+		return fmt.Errorf("new route was added but the old one could not be removed: %w", err)
+	}
+	return nil
+}
 
-	return netlink.RouteReplace(routeObj)
+// sameKernelRoute reports whether the kernel would treat both routes as one entry,
+// so that RouteReplace on one overwrites the other.
+func sameKernelRoute(a, b StaticRoute) bool {
+	dstA, errA := NormalizeCIDR(a.Destination)
+	dstB, errB := NormalizeCIDR(b.Destination)
+	return errA == nil && errB == nil && dstA == dstB &&
+		a.Metric == b.Metric && tableOrMain(a.Table) == tableOrMain(b.Table)
 }
 
-// Delete removes a static route from the system's routing table.
-func Delete(route StaticRoute) error {
-	link, err := netlink.LinkByName(route.Interface)
+// tableOrMain maps the "unset" table 0 to the main table, like the kernel does.
+func tableOrMain(table int) int {
+	if table == 0 {
+		return MainTable
+	}
+	return table
+}
+
+// addWith is Add on a specific netlink handle, so batches can share one socket.
+func addWith(h *netlink.Handle, route StaticRoute) error {
+	routeObj, err := buildAddedRoute(h, route)
 	if err != nil {
-		return fmt.Errorf("interface %s not found: %w", route.Interface, err)
+		return err
 	}
+	return h.RouteReplace(routeObj)
+}
 
-	_, dst, err := net.ParseCIDR(route.Destination)
+// buildAddedRoute is buildRoute with the scope and flags a route is added with.
+func buildAddedRoute(h *netlink.Handle, route StaticRoute) (*netlink.Route, error) {
+	routeObj, err := buildRoute(h, route)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsSpecialType(route.Type) || route.IsMultipath() {
+		return routeObj, nil
+	}
+	if routeObj.Gw == nil {
+		// No gateway: the destination is directly reachable on the interface,
+		// like `ip route add 10.8.0.0/16 dev tun0`.
+		routeObj.Scope = netlink.SCOPE_LINK
+	} else if route.OnLink {
+		// Trust that the gateway is reachable on the interface even though
+		// it is outside the interface's subnet.
+		routeObj.Flags |= int(netlink.FLAG_ONLINK)
+	}
+	return routeObj, nil
+}
+
+// deleteWith is Delete on a specific netlink handle.
+func deleteWith(h *netlink.Handle, route StaticRoute) error {
+	routeObj, err := buildRoute(h, route)
 	if err != nil {
-		return fmt.Errorf("invalid destination CIDR %s: %w", route.Destination, err)
+		return err
 	}
 
 	// ⭐️ Safety check to prevent deleting the default route.
 	// The IsUnspecified method checks for 0.0.0.0 (IPv4) or :: (IPv6).
-	if dst.IP.IsUnspecified() {
+	// Default routes in other tables, such as those of source routing, may go.
+	if routeObj.Dst.IP.IsUnspecified() && tableOrMain(route.Table) == MainTable {
 		return errors.New("deleting the default route is not allowed")
 	}
 
-	gw := net.ParseIP(route.Gateway)
-	if gw == nil {
-		return fmt.Errorf("invalid gateway IP %s", route.Gateway)
+	// Like `ip route del`, match routes of any scope, so device routes
+	// (scope link) can be deleted as well as routes via a gateway.
+	routeObj.Scope = netlink.SCOPE_NOWHERE
+
+	return h.RouteDel(routeObj)
+}
+
+// buildRoute converts a StaticRoute into the netlink route shared by add and delete.
+// Metric and table are always set because they are part of the kernel's route
+// identity; without them RouteDel could remove a different route to the same destination.
+func buildRoute(h *netlink.Handle, route StaticRoute) (*netlink.Route, error) {
+	_, dst, err := net.ParseCIDR(route.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination CIDR %s: %w", route.Destination, err)
+	}
+
+	kernelType, err := kernelRouteType(route.Type)
+	if err != nil {
+		return nil, err
 	}
 
 	routeObj := &netlink.Route{
-		LinkIndex: link.Attrs().Index,
-		Dst:       dst,
-		Gw:        gw,
+		Dst:      dst,
+		Priority: route.Metric,
+		Table:    route.Table,
+		Type:     kernelType,
+		MTU:      route.MTU,
+		AdvMSS:   route.AdvMSS,
+		InitCwnd: route.InitCwnd,
+		InitRwnd: route.InitRwnd,
+		Congctl:  route.Congestion,
+	}
+	if IsSpecialType(route.Type) {
+		// Blackhole, unreachable, prohibit and throw routes never forward
+		// traffic, so they have no interface or gateway.
+		return routeObj, nil
+	}
+
+	if route.IsMultipath() {
+		if routeObj.MultiPath, err = buildNextHops(h, route.NextHops); err != nil {
+			return nil, err
+		}
+	} else {
+		link, err := resolveLink(h, route)
+		if err != nil {
+			return nil, err
+		}
+		routeObj.LinkIndex = link.Attrs().Index
+
+		if routeObj.Gw, err = parseGateway(route); err != nil {
+			return nil, err
+		}
+	}
+
+	if route.Src != "" {
+		if routeObj.Src = net.ParseIP(route.Src); routeObj.Src == nil {
+			return nil, fmt.Errorf("invalid source IP %s", route.Src)
+		}
 	}
 
-	return netlink.RouteDel(routeObj)
+	return routeObj, nil
+}
+
+// parseGateway returns the gateway of a route, or nil for a device-only route.
+func parseGateway(route StaticRoute) (net.IP, error) {
+	if route.Gateway == "" {
+		if route.OnLink {
+			return nil, errors.New("onlink needs a gateway")
+		}
+		return nil, nil
+	}
+	gw := net.ParseIP(route.Gateway)
+	if gw == nil {
+		return nil, fmt.Errorf("invalid gateway IP %s", route.Gateway)
+	}
+	return gw, nil
+}
+
+// buildNextHops converts the next hops of a multipath route. The kernel stores
+// a weight as "hops", which is the weight minus one.
+func buildNextHops(h *netlink.Handle, hops []NextHop) ([]*netlink.NexthopInfo, error) {
+	var infos []*netlink.NexthopInfo
+	for _, hop := range hops {
+		link, err := linkByName(h, hop.Interface)
+		if err != nil {
+			return nil, err
+		}
+		gw, err := parseGateway(StaticRoute{Gateway: hop.Gateway, OnLink: hop.OnLink})
+		if err != nil {
+			return nil, err
+		}
+		if err := checkWeight(hop.Weight); err != nil {
+			return nil, fmt.Errorf("next hop dev %s: %w", hop.Interface, err)
+		}
+
+		info := &netlink.NexthopInfo{
+			LinkIndex: link.Attrs().Index,
+			Gw:        gw,
+			Hops:      max(hop.Weight, 1) - 1,
+		}
+		if hop.OnLink {
+			info.Flags |= int(netlink.FLAG_ONLINK)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
 }
@@ -0,0 +1,150 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Rules are saved next to the routes, in a file of their own.
+const rulesFile = "rules.json"
+
+var (
+	// ErrRuleNotFound is returned when no saved rule has the requested ID.
+	ErrRuleNotFound = errors.New("saved rule not found")
+	// ErrDuplicateRule is returned when an update would make two saved rules identical.
+	ErrDuplicateRule = errors.New("an identical rule is already saved")
+)
+
+// saveRules overwrites rules.json with the given rules.
+// The caller holds the store's lock.
+func saveRules(rules []Rule) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFile(StoreDir(), rulesFile, data)
+}
+
+// LoadRules reads all saved rules. A missing file means no rules were saved yet.
+func LoadRules() ([]Rule, error) {
+	data, err := readStoreFile(StoreDir(), rulesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Rule{}, nil
+		}
+		return nil, err
+	}
+
+	var rules []Rule
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// AppendRules saves new rules. Rules that are already saved are skipped.
+func AppendRules(newRules []Rule) error {
+	return modifyRules(func(rules []Rule) ([]Rule, error) {
+		for _, newRule := range newRules {
+			if err := normalizeRule(&newRule); err != nil {
+				return nil, err
+			}
+			if indexOfSameRule(rules, newRule, "") >= 0 {
+				continue
+			}
+			newRule.ID = newRouteID()
+			if newRule.CreatedAt.IsZero() {
+				newRule.CreatedAt = time.Now()
+			}
+			rules = append(rules, newRule)
+		}
+		return rules, nil
+	})
+}
+
+// UpdateRule replaces the saved rule that has the same ID as updated.
+func UpdateRule(updated Rule) error {
+	if err := normalizeRule(&updated); err != nil {
+		return err
+	}
+	return modifyRules(func(rules []Rule) ([]Rule, error) {
+		i := indexOfRuleID(rules, updated.ID)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, updated.ID)
+		}
+		if indexOfSameRule(rules, updated, updated.ID) >= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateRule, updated)
+		}
+		updated.CreatedAt = rules[i].CreatedAt
+		rules[i] = updated
+		return rules, nil
+	})
+}
+
+// DeleteSavedRule removes the saved rule with the given ID.
+func DeleteSavedRule(id string) error {
+	return modifyRules(func(rules []Rule) ([]Rule, error) {
+		i := indexOfRuleID(rules, id)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+		}
+		return append(rules[:i:i], rules[i+1:]...), nil
+	})
+}
+
+// modifyRules does a read-modify-write of the saved rules while holding the store's lock.
+func modifyRules(modify func(rules []Rule) ([]Rule, error)) error {
+	dir := StoreDir()
+	return withStoreLock(dir, func() error {
+		rules, err := LoadRules()
+		if err != nil {
+			return err
+		}
+		if rules, err = modify(rules); err != nil {
+			return err
+		}
+		return saveRules(rules)
+	})
+}
+
+// normalizeRule brings the prefixes into canonical form and stores main as table 0.
+func normalizeRule(rule *Rule) error {
+	for _, prefix := range []*string{&rule.From, &rule.To} {
+		if *prefix == "" {
+			continue
+		}
+		normalized, err := NormalizeCIDR(*prefix)
+		if err != nil {
+			return err
+		}
+		*prefix = normalized
+	}
+	if rule.Table == MainTable {
+		rule.Table = 0
+	}
+	return nil
+}
+
+func indexOfSameRule(rules []Rule, rule Rule, skipID string) int {
+	for i, r := range rules {
+		if r.ID != skipID && r.SameRule(rule) {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfRuleID(rules []Rule, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, r := range rules {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
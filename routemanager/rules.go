@@ -0,0 +1,481 @@
+package routemanager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ErrProtectedRule is returned when asked to change one of the kernel's default rules.
+var ErrProtectedRule = errors.New("the default rules can't be changed")
+
+// Rule is a policy routing rule, as managed by `ip rule`. It sends the traffic
+// matching all of its selectors to Table. Empty selectors match everything.
+type Rule struct {
+	// ID identifies a saved rule in rules.json, like StaticRoute.ID.
+	ID       string    `json:"id,omitempty"`
+	Priority int       `json:"priority,omitempty"` // Lower is tried first. 0 lets the kernel decide
+	From     string    `json:"from,omitempty"`     // Source prefix
+	To       string    `json:"to,omitempty"`       // Destination prefix
+	FwMark   uint32    `json:"fwmark,omitempty"`
+	FwMask   uint32    `json:"fwmask,omitempty"` // 0 compares the whole mark
+	Iif      string    `json:"iif,omitempty"`    // Incoming interface
+	Oif      string    `json:"oif,omitempty"`    // Outgoing interface, for sockets bound to it
+	UIDRange *UIDRange `json:"uidrange,omitempty"`
+	Table    int       `json:"table,omitempty"` // Table to look up, 0 means "main"
+	// Namespace is the network namespace the rule lives in, like StaticRoute.Namespace.
+	Namespace string `json:"netns,omitempty"`
+
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+}
+
+// UIDRange selects the traffic of local processes run by these users.
+type UIDRange struct {
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+// SystemRule is a rule currently in the kernel.
+type SystemRule struct {
+	Rule
+	Action string // Empty for "lookup", otherwise e.g. "goto" or "blackhole", which we only show
+	Invert bool   // "not": the rule matches the traffic its selectors don't, which we only show
+	// Extra holds the selectors and options Rule has no field for, in `ip rule` syntax,
+	// e.g. "suppress_prefixlength 0" of wg-quick. Rules with any are only shown.
+	Extra string
+}
+
+// Protected reports whether the rule must be left alone: the kernel's default
+// lookups of the local, main and default tables, and rules we can't express.
+// Adding such a rule again from its Rule would drop what Rule can't hold.
+func (r SystemRule) Protected() bool {
+	return r.Action != "" || r.Invert || r.Extra != "" || r.IsDefault()
+}
+
+// Selector is Rule.Selector with what Rule has no field for.
+func (r SystemRule) Selector() string {
+	text := r.Rule.Selector()
+	if r.Invert {
+		text = "not " + text
+	}
+	if r.Extra != "" {
+		text += " " + r.Extra
+	}
+	return text
+}
+
+// IsDefault reports whether this is one of the three rules the kernel starts with.
+func (r Rule) IsDefault() bool {
+	if r.From != "" || r.To != "" || r.FwMark != 0 || r.Iif != "" || r.Oif != "" || r.UIDRange != nil {
+		return false
+	}
+	switch tableOrMain(r.Table) {
+	case unix.RT_TABLE_LOCAL:
+		return r.Priority == 0
+	case unix.RT_TABLE_MAIN:
+		return r.Priority == 32766
+	case unix.RT_TABLE_DEFAULT:
+		return r.Priority == 32767
+	}
+	return false
+}
+
+// SameRule reports whether two rules have the same selectors, priority and table.
+// Prefixes must already be normalized.
+func (r Rule) SameRule(other Rule) bool {
+	return r.Priority == other.Priority && r.sameSelectors(other)
+}
+
+// Matches reports whether a live rule is the one described by this saved rule.
+// A saved priority of 0 matches whatever priority the kernel chose.
+// Live rules with selectors Rule can't hold never match.
+func (r Rule) Matches(s SystemRule) bool {
+	return s.Action == "" && !s.Invert && s.Extra == "" &&
+		(r.Priority == 0 || r.Priority == s.Priority) && r.sameSelectors(s.Rule)
+}
+
+func (r Rule) sameSelectors(other Rule) bool {
+	return r.Namespace == other.Namespace &&
+		r.From == other.From &&
+		r.To == other.To &&
+		r.FwMark == other.FwMark &&
+		r.FwMask == other.FwMask &&
+		r.Iif == other.Iif &&
+		r.Oif == other.Oif &&
+		(r.UIDRange == nil) == (other.UIDRange == nil) &&
+		(r.UIDRange == nil || *r.UIDRange == *other.UIDRange) &&
+		tableOrMain(r.Table) == tableOrMain(other.Table)
+}
+
+// Selector formats what the rule matches, the way `ip rule` prints it.
+func (r Rule) Selector() string {
+	from := r.From
+	if from == "" {
+		from = "all"
+	}
+	text := "from " + from
+	if r.To != "" {
+		text += " to " + r.To
+	}
+	if r.FwMark != 0 {
+		text += fmt.Sprintf(" fwmark %#x", r.FwMark)
+		if r.FwMask != 0 {
+			text += fmt.Sprintf("/%#x", r.FwMask)
+		}
+	}
+	if r.Iif != "" {
+		text += " iif " + r.Iif
+	}
+	if r.Oif != "" {
+		text += " oif " + r.Oif
+	}
+	if r.UIDRange != nil {
+		text += fmt.Sprintf(" uidrange %d-%d", r.UIDRange.Start, r.UIDRange.End)
+	}
+	return text
+}
+
+// String formats the rule the way `ip rule add` accepts it.
+func (r Rule) String() string {
+	text := r.Selector()
+	if r.Priority != 0 {
+		text += fmt.Sprintf(" priority %d", r.Priority)
+	}
+	return text + " lookup " + TableName(tableOrMain(r.Table))
+}
+
+// ListRules returns the IPv4 policy routing rules of the current namespace,
+// in the order the kernel tries them.
+func ListRules() ([]SystemRule, error) {
+	return ListRulesIn(CurrentNamespace())
+}
+
+// ListRulesIn is ListRules for the given namespace, "" being the host's.
+// Every listed rule carries that namespace.
+func ListRulesIn(namespace string) ([]SystemRule, error) {
+	h, err := handleFor(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	rules, err := h.RuleList(netlink.FAMILY_V4)
+	if err != nil {
+		return nil, fmt.Errorf("could not list rules: %w", err)
+	}
+
+	systemRules := make([]SystemRule, 0, len(rules))
+	for _, r := range rules {
+		systemRules = append(systemRules, systemRuleOf(r, namespace))
+	}
+	return systemRules, nil
+}
+
+// systemRuleOf converts a rule listed by netlink into a SystemRule of the namespace.
+func systemRuleOf(r netlink.Rule, namespace string) SystemRule {
+	rule := Rule{
+		Priority: r.Priority,
+		FwMark:   r.Mark,
+		Iif:      r.IifName,
+		Oif:      r.OifName,
+		Table:    r.Table,
+
+		Namespace: namespace,
+	}
+	if r.Src != nil {
+		rule.From = r.Src.String()
+	}
+	if r.Dst != nil {
+		rule.To = r.Dst.String()
+	}
+	if r.Mask != nil && *r.Mask != 0xffffffff {
+		rule.FwMask = *r.Mask
+	}
+	if r.UIDRange != nil {
+		rule.UIDRange = &UIDRange{Start: r.UIDRange.Start, End: r.UIDRange.End}
+	}
+	if rule.Table == MainTable {
+		rule.Table = 0
+	}
+	return SystemRule{Rule: rule, Action: ruleAction(r), Invert: r.Invert, Extra: ruleExtra(r)}
+}
+
+// ruleExtra formats the selectors and options of a listed rule that Rule has no
+// field for, the way `ip rule` prints them. netlink lists unset ones as 0 or -1.
+func ruleExtra(r netlink.Rule) string {
+	var parts []string
+	if r.Tos != 0 {
+		parts = append(parts, fmt.Sprintf("tos %#x", r.Tos))
+	}
+	if r.IPProto > 0 {
+		parts = append(parts, fmt.Sprintf("ipproto %d", r.IPProto))
+	}
+	for _, ports := range []struct {
+		name  string
+		value *netlink.RulePortRange
+	}{{"sport", r.Sport}, {"dport", r.Dport}} {
+		switch {
+		case ports.value == nil:
+		case ports.value.Start == ports.value.End:
+			parts = append(parts, fmt.Sprintf("%s %d", ports.name, ports.value.Start))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %d-%d", ports.name, ports.value.Start, ports.value.End))
+		}
+	}
+	if r.TunID > 0 {
+		parts = append(parts, fmt.Sprintf("tun_id %d", r.TunID))
+	}
+	if r.Flow >= 0 {
+		parts = append(parts, fmt.Sprintf("realms %d", r.Flow))
+	}
+	if r.SuppressPrefixlen >= 0 {
+		parts = append(parts, fmt.Sprintf("suppress_prefixlength %d", r.SuppressPrefixlen))
+	}
+	if r.SuppressIfgroup >= 0 {
+		parts = append(parts, fmt.Sprintf("suppress_ifgroup %d", r.SuppressIfgroup))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ruleAction names the action of a listed rule. netlink doesn't report the FR_ACT_*
+// type of listed rules, so without one a rule is told apart by what it points to:
+// a goto has a target, a lookup has a table, and the other actions have neither.
+func ruleAction(r netlink.Rule) string {
+	switch {
+	case r.Type != 0:
+		return ruleActionName(r.Type)
+	case r.Goto >= 0:
+		return "goto"
+	case r.Table != 0:
+		return ""
+	}
+	return "no lookup"
+}
+
+// ruleActionName names the FR_ACT_* action of a rule. Plain table lookups have no name.
+func ruleActionName(action uint8) string {
+	switch action {
+	case unix.FR_ACT_TO_TBL:
+		return ""
+	case unix.FR_ACT_GOTO:
+		return "goto"
+	case unix.FR_ACT_NOP:
+		return "nop"
+	case unix.FR_ACT_BLACKHOLE:
+		return "blackhole"
+	case unix.FR_ACT_UNREACHABLE:
+		return "unreachable"
+	case unix.FR_ACT_PROHIBIT:
+		return "prohibit"
+	}
+	return fmt.Sprintf("action %d", action)
+}
+
+// AddRule adds a rule to its namespace.
+func AddRule(rule Rule) error {
+	kernelRule, err := buildRule(rule)
+	if err != nil {
+		return err
+	}
+	h, err := handleFor(rule.Namespace)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	if err := h.RuleAdd(kernelRule); err != nil {
+		return fmt.Errorf("failed to add rule %s: %w", rule, err)
+	}
+	return nil
+}
+
+// DeleteRule removes a rule from its namespace. The default rules are refused,
+// since deleting the main table lookup cuts the host off the network.
+func DeleteRule(rule Rule) error {
+	if rule.IsDefault() {
+		return fmt.Errorf("%w: %s", ErrProtectedRule, rule)
+	}
+	kernelRule, err := buildRule(rule)
+	if err != nil {
+		return err
+	}
+	h, err := handleFor(rule.Namespace)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	if err := h.RuleDel(kernelRule); err != nil {
+		return fmt.Errorf("failed to delete rule %s: %w", rule, err)
+	}
+	return nil
+}
+
+// EnsureRule adds a rule unless the kernel has it already, so applying it again is
+// harmless. Without a priority, any rule with the same selectors and table counts:
+// the kernel would give every add a new priority and pile up copies. With a priority,
+// copies of the rule under other priorities are removed.
+func EnsureRule(rule Rule) error {
+	live, err := ListRulesIn(rule.Namespace)
+	if err != nil {
+		return err
+	}
+	anyPriority := rule
+	anyPriority.Priority = 0
+
+	present := false
+	var errs []error
+	for _, s := range live {
+		if !anyPriority.Matches(s) {
+			continue
+		}
+		if rule.Priority == 0 || s.Priority == rule.Priority {
+			present = true
+			continue
+		}
+		if err := DeleteRule(s.Rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !present {
+		if err := AddRule(rule); err != nil && !errors.Is(err, unix.EEXIST) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteMatchingRules removes every rule the kernel has that matches rule, which
+// without a priority means every copy of it. It reports how many were removed.
+func DeleteMatchingRules(rule Rule) (int, error) {
+	live, err := ListRulesIn(rule.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var errs []error
+	for _, s := range live {
+		if !rule.Matches(s) {
+			continue
+		}
+		if err := DeleteRule(s.Rule); err != nil && !errors.Is(err, unix.ENOENT) {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// ReplaceRule swaps old for updated. Rules have no in-place replace, so the new
+// rule is added first and the old one only removed once that worked.
+func ReplaceRule(old, updated Rule) error {
+	if old.IsDefault() {
+		return fmt.Errorf("%w: %s", ErrProtectedRule, old)
+	}
+	if old.Namespace != updated.Namespace {
+		return errors.New("a rule can't be moved to another namespace, add it there instead")
+	}
+	if err := normalizeRule(&updated); err != nil {
+		return err
+	}
+	if old.SameRule(updated) {
+		return nil // Only the description changed, the kernel doesn't know about it
+	}
+	if err := AddRule(updated); err != nil {
+		return err
+	}
+	return DeleteRule(old)
+}
+
+// buildRule converts a Rule into a netlink.Rule.
+func buildRule(rule Rule) (*netlink.Rule, error) {
+	kernelRule := netlink.NewRule()
+	kernelRule.Family = netlink.FAMILY_V4
+	kernelRule.Table = tableOrMain(rule.Table)
+	kernelRule.Mark = rule.FwMark
+	kernelRule.IifName = rule.Iif
+	kernelRule.OifName = rule.Oif
+	if rule.Priority != 0 {
+		kernelRule.Priority = rule.Priority
+	}
+	if rule.FwMask != 0 {
+		mask := rule.FwMask
+		kernelRule.Mask = &mask
+	}
+	if rule.UIDRange != nil {
+		if rule.UIDRange.Start > rule.UIDRange.End {
+			return nil, fmt.Errorf("invalid uid range %d-%d", rule.UIDRange.Start, rule.UIDRange.End)
+		}
+		kernelRule.UIDRange = netlink.NewRuleUIDRange(rule.UIDRange.Start, rule.UIDRange.End)
+	}
+
+	var err error
+	if kernelRule.Src, err = parseRulePrefix(rule.From); err != nil {
+		return nil, err
+	}
+	if kernelRule.Dst, err = parseRulePrefix(rule.To); err != nil {
+		return nil, err
+	}
+	return kernelRule, nil
+}
+
+// parseRulePrefix parses an optional from/to prefix, where empty means "all".
+func parseRulePrefix(prefix string) (*net.IPNet, error) {
+	if prefix == "" {
+		return nil, nil
+	}
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule prefix %s: %w", prefix, err)
+	}
+	return ipNet, nil
+}
+
+// ParseFwMark parses a firewall mark as `ip rule` takes it, "0x10" or "0x10/0xff".
+// An empty string is no mark.
+func ParseFwMark(s string) (mark, mask uint32, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, nil
+	}
+	markText, maskText, hasMask := strings.Cut(s, "/")
+	m, err := strconv.ParseUint(markText, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid fwmark %q", s)
+	}
+	if hasMask {
+		k, err := strconv.ParseUint(maskText, 0, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid fwmark mask %q", s)
+		}
+		mask = uint32(k)
+	}
+	return uint32(m), mask, nil
+}
+
+// ParseUIDRange parses "1000-1999" or a single "1000". An empty string is no range.
+func ParseUIDRange(s string) (*UIDRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	startText, endText, isRange := strings.Cut(s, "-")
+	if !isRange {
+		endText = startText
+	}
+	start, err := strconv.ParseUint(strings.TrimSpace(startText), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid range %q", s)
+	}
+	end, err := strconv.ParseUint(strings.TrimSpace(endText), 10, 32)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("invalid uid range %q", s)
+	}
+	return &UIDRange{Start: uint32(start), End: uint32(end)}, nil
+}
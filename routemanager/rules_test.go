@@ -0,0 +1,125 @@
+package routemanager
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// listedRule is a rule the way netlink lists it, changed by set.
+func listedRule(priority, table int, set func(r *netlink.Rule)) netlink.Rule {
+	r := netlink.NewRule()
+	r.Family = netlink.FAMILY_V4
+	r.Priority = priority
+	r.Table = table
+	if set != nil {
+		set(r)
+	}
+	return *r
+}
+
+func TestSystemRuleOf(t *testing.T) {
+	_, office, _ := net.ParseCIDR("192.168.1.0/24")
+	mark := uint32(0xff)
+
+	tests := []struct {
+		name      string
+		rule      netlink.Rule
+		selector  string
+		protected bool
+	}{
+		{
+			name:     "plain lookup",
+			rule:     listedRule(100, 100, func(r *netlink.Rule) { r.Src = office }),
+			selector: "from 192.168.1.0/24",
+		},
+		{
+			name:     "fwmark with mask",
+			rule:     listedRule(100, 100, func(r *netlink.Rule) { r.Mark, r.Mask = 0x10, &mark }),
+			selector: "from all fwmark 0x10/0xff",
+		},
+		{
+			name:      "main table",
+			rule:      listedRule(32766, MainTable, nil),
+			selector:  "from all",
+			protected: true,
+		},
+		{
+			name: "wg-quick fwmark",
+			rule: listedRule(32765, 51820, func(r *netlink.Rule) {
+				r.Invert = true
+				r.Mark = 0xca6c
+			}),
+			selector:  "not from all fwmark 0xca6c",
+			protected: true,
+		},
+		{
+			name:      "wg-quick suppress_prefixlength",
+			rule:      listedRule(32764, MainTable, func(r *netlink.Rule) { r.SuppressPrefixlen = 0 }),
+			selector:  "from all suppress_prefixlength 0",
+			protected: true,
+		},
+		{
+			name:      "suppress_ifgroup",
+			rule:      listedRule(100, MainTable, func(r *netlink.Rule) { r.SuppressIfgroup = 1 }),
+			selector:  "from all suppress_ifgroup 1",
+			protected: true,
+		},
+		{
+			name:      "tos",
+			rule:      listedRule(100, 100, func(r *netlink.Rule) { r.Tos = 0x10 }),
+			selector:  "from all tos 0x10",
+			protected: true,
+		},
+		{
+			name: "ipproto and ports",
+			rule: listedRule(100, 100, func(r *netlink.Rule) {
+				r.IPProto = 6
+				r.Sport = netlink.NewRulePortRange(1024, 2048)
+				r.Dport = netlink.NewRulePortRange(443, 443)
+			}),
+			selector:  "from all ipproto 6 sport 1024-2048 dport 443",
+			protected: true,
+		},
+		{
+			name:      "tun_id",
+			rule:      listedRule(100, 100, func(r *netlink.Rule) { r.TunID = 7 }),
+			selector:  "from all tun_id 7",
+			protected: true,
+		},
+		{
+			name:      "realms",
+			rule:      listedRule(100, 100, func(r *netlink.Rule) { r.Flow = 2 }),
+			selector:  "from all realms 2",
+			protected: true,
+		},
+		{
+			name:      "goto",
+			rule:      listedRule(100, 0, func(r *netlink.Rule) { r.Goto = 200 }),
+			selector:  "from all",
+			protected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := systemRuleOf(tt.rule, "lab")
+			if got := s.Selector(); got != tt.selector {
+				t.Errorf("Selector() = %q, want %q", got, tt.selector)
+			}
+			if got := s.Protected(); got != tt.protected {
+				t.Errorf("Protected() = %v, want %v", got, tt.protected)
+			}
+			if s.Namespace != "lab" {
+				t.Errorf("Namespace = %q, want \"lab\"", s.Namespace)
+			}
+
+			// A saved rule must never stand for a live one it can't recreate.
+			saved := s.Rule
+			saved.Priority = 0
+			if !s.IsDefault() && saved.Matches(s) == tt.protected {
+				t.Errorf("Matches() = %v for a rule that is protected: %v", !tt.protected, tt.protected)
+			}
+		})
+	}
+}
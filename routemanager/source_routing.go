@@ -0,0 +1,466 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// Source routing setups are saved in a file of their own, each one as a unit.
+const sourceRoutesFile = "source_routes.json"
+
+// firstSourceTable is where the wizard starts looking for free table numbers.
+const firstSourceTable = 100
+
+// sourceRulePriority is the priority of the rules of all setups. A fixed one lets the
+// kernel recognize a rule that is already there; it comes after the rules people
+// usually add by hand and before the lookup of the main table at 32766.
+const sourceRulePriority = 30000
+
+// SourceRoute makes a dual-homed host answer on the interface a connection came in on.
+// It gives the interface a table of its own, with its subnet and a default route
+// through its gateway, and a rule that sends traffic from the interface's address
+// to that table. All parts are applied, saved and removed together.
+type SourceRoute struct {
+	ID        string    `json:"id,omitempty"`
+	Interface string    `json:"interface"`
+	Gateway   string    `json:"gateway"`
+	Table     int       `json:"table"`
+	Address   string    `json:"address,omitempty"` // Interface address in CIDR form when last applied
+	Namespace string    `json:"netns,omitempty"`   // Network namespace of the interface, empty for the host's own
+	CreatedAt time.Time `json:"created_at,omitzero"`
+}
+
+// sourceWatch is the running WatchSourceRoutes, so that ConfigureSourceRoutes can
+// have it follow a namespace that gets its first setup.
+var sourceWatch struct {
+	sync.Mutex
+	done     <-chan struct{}
+	onChange func()
+	watched  map[string]bool // Namespaces subscribed to; nil while nothing is watched
+}
+
+// sourceSyncMu keeps the watchers of several namespaces and ConfigureSourceRoutes from
+// changing the setups at the same time. The store's lock is only held while the result
+// is written, so the kernel is changed without holding up every other save.
+var sourceSyncMu sync.Mutex
+
+// Routes returns the routes of the interface's own table.
+func (s SourceRoute) Routes() []StaticRoute {
+	routes := []StaticRoute{{
+		Destination: "0.0.0.0/0",
+		Interface:   s.Interface,
+		Gateway:     s.Gateway,
+		Table:       s.Table,
+		Namespace:   s.Namespace,
+	}}
+	if ip, subnet, err := net.ParseCIDR(s.Address); err == nil {
+		routes = append(routes, StaticRoute{
+			Destination: subnet.String(),
+			Interface:   s.Interface,
+			Src:         ip.String(),
+			Table:       s.Table,
+			Namespace:   s.Namespace,
+		})
+	}
+	return routes
+}
+
+// Rule returns the rule that sends traffic from the interface's address to its table.
+func (s SourceRoute) Rule() (Rule, bool) {
+	ip, _, err := net.ParseCIDR(s.Address)
+	if err != nil {
+		return Rule{}, false
+	}
+	return Rule{Priority: sourceRulePriority, From: ip.String() + "/32", Table: s.Table, Namespace: s.Namespace}, true
+}
+
+// SuggestSourceRoutes proposes a setup for each interface of a namespace: its current
+// address and default gateway, and a table that no other setup or named table uses yet.
+func SuggestSourceRoutes(namespace string, interfaces []string) ([]SourceRoute, error) {
+	saved, err := LoadSourceRoutes()
+	if err != nil {
+		return nil, err
+	}
+	used := map[int]bool{}
+	for _, table := range RoutingTables() {
+		used[table.ID] = true
+	}
+	for _, s := range saved {
+		used[s.Table] = true
+	}
+
+	var suggestions []SourceRoute
+	table := firstSourceTable
+	for _, name := range interfaces {
+		if i := slices.IndexFunc(saved, func(s SourceRoute) bool { return s.Namespace == namespace && s.Interface == name }); i >= 0 {
+			suggestions = append(suggestions, saved[i])
+			continue
+		}
+		for used[table] {
+			table++
+		}
+		used[table] = true
+		address, _ := interfaceAddress(namespace, name)
+		suggestions = append(suggestions, SourceRoute{
+			Interface: name,
+			Gateway:   interfaceGateway(namespace, name),
+			Table:     table,
+			Address:   address,
+			Namespace: namespace,
+		})
+	}
+	return suggestions, nil
+}
+
+// ApplySourceRoute installs the table and rule of a setup. Applying it twice is harmless:
+// the rule is only added once, see EnsureRule.
+func ApplySourceRoute(s SourceRoute) error {
+	if s.Gateway == "" {
+		return fmt.Errorf("source routing for %s needs a gateway", s.Interface)
+	}
+	for _, route := range s.Routes() {
+		if err := Add(route); err != nil {
+			return fmt.Errorf("source routing for %s: %w", s.Interface, err)
+		}
+	}
+	rule, ok := s.Rule()
+	if !ok {
+		return fmt.Errorf("source routing for %s: the interface has no IPv4 address", s.Interface)
+	}
+	if err := EnsureRule(rule); err != nil {
+		return fmt.Errorf("source routing for %s: %w", s.Interface, err)
+	}
+	return nil
+}
+
+// RemoveSourceRoute removes the rule and the routes of a setup, as far as they exist.
+// Every copy of the rule goes, including those older versions added under a priority
+// the kernel chose.
+func RemoveSourceRoute(s SourceRoute) error {
+	var errs []error
+	if rule, ok := s.Rule(); ok {
+		rule.Priority = 0
+		if _, err := DeleteMatchingRules(rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, route := range s.Routes() {
+		if err := Delete(route); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("source routing for %s: %w", s.Interface, err)
+	}
+	return nil
+}
+
+// SyncSourceRoutes moves every saved setup to the current address and gateway of its
+// interface, e.g. after DHCP handed out a new lease. The gateway is the one of the
+// interface's default route in the main table. It reports whether anything changed.
+func SyncSourceRoutes() (bool, error) {
+	sourceSyncMu.Lock()
+	defer sourceSyncMu.Unlock()
+
+	// 1. MOVE THE SETUPS IN THE KERNEL
+	saved, err := LoadSourceRoutes()
+	if err != nil {
+		return false, err
+	}
+	var moved []SourceRoute
+	var errs []error
+	for _, s := range saved {
+		address, err := interfaceAddress(s.Namespace, s.Interface)
+		if err != nil {
+			continue // Interface is gone or down for now
+		}
+		gateway := interfaceGateway(s.Namespace, s.Interface)
+		if gateway == "" {
+			gateway = s.Gateway // No default route through it right now, keep the one we know
+		}
+		if address == s.Address && gateway == s.Gateway {
+			continue
+		}
+		if err := RemoveSourceRoute(s); err != nil {
+			log.Printf("WARN: Could not remove the old source routing: %v", err)
+		}
+		s.Address, s.Gateway = address, gateway
+		if err := ApplySourceRoute(s); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		moved = append(moved, s)
+	}
+	if len(moved) == 0 {
+		return false, errors.Join(errs...)
+	}
+
+	// 2. RECORD WHERE THEY ARE NOW
+	err = modifySourceRoutes(func(setups []SourceRoute) ([]SourceRoute, error) {
+		for _, s := range moved {
+			if i := indexOfSourceRoute(setups, s.Namespace, s.Interface); i >= 0 {
+				setups[i].Address, setups[i].Gateway = s.Address, s.Gateway
+			}
+		}
+		return setups, nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return true, errors.Join(errs...)
+}
+
+// indexOfSourceRoute finds the setup of an interface. Each interface has one per namespace.
+func indexOfSourceRoute(setups []SourceRoute, namespace, iface string) int {
+	return slices.IndexFunc(setups, func(s SourceRoute) bool {
+		return s.Namespace == namespace && s.Interface == iface
+	})
+}
+
+// WatchSourceRoutes keeps the saved setups in sync with the interface addresses and
+// gateways until done is closed. onChange is called after a setup was moved. It follows
+// the host and every namespace that has a setup, and later ones ConfigureSourceRoutes
+// sets up in.
+func WatchSourceRoutes(done <-chan struct{}, onChange func()) error {
+	saved, err := LoadSourceRoutes()
+	if err != nil {
+		return err
+	}
+	sourceWatch.Lock()
+	sourceWatch.done, sourceWatch.onChange, sourceWatch.watched = done, onChange, map[string]bool{}
+	sourceWatch.Unlock()
+
+	errs := []error{watchSourceNamespace("")}
+	for _, s := range saved {
+		errs = append(errs, watchSourceNamespace(s.Namespace))
+	}
+	return errors.Join(errs...)
+}
+
+// watchSourceNamespace has the running watcher follow the interfaces of a namespace.
+// Without a running watcher, or when it follows the namespace already, it does nothing.
+func watchSourceNamespace(namespace string) error {
+	sourceWatch.Lock()
+	defer sourceWatch.Unlock()
+	if sourceWatch.watched == nil || sourceWatch.watched[namespace] {
+		return nil
+	}
+
+	// The subscriptions keep their sockets in the namespace, the handle isn't needed after.
+	ns := netns.None()
+	if namespace != "" {
+		var err error
+		if ns, err = openNamespace(namespace); err != nil {
+			return err
+		}
+		defer ns.Close()
+	}
+	addrUpdates := make(chan netlink.AddrUpdate)
+	err := netlink.AddrSubscribeWithOptions(addrUpdates, sourceWatch.done, netlink.AddrSubscribeOptions{Namespace: &ns})
+	if err != nil {
+		return fmt.Errorf("could not watch interface addresses: %w", err)
+	}
+	// DHCP may also move the gateway and keep the address.
+	routeUpdates := make(chan netlink.RouteUpdate)
+	err = netlink.RouteSubscribeWithOptions(routeUpdates, sourceWatch.done, netlink.RouteSubscribeOptions{Namespace: &ns})
+	if err != nil {
+		return fmt.Errorf("could not watch routes: %w", err)
+	}
+	sourceWatch.watched[namespace] = true
+
+	onChange := sourceWatch.onChange
+	sync := func() {
+		changed, err := SyncSourceRoutes()
+		if err != nil {
+			log.Printf("ERROR: Could not update source routing: %v", err)
+		}
+		if changed && onChange != nil {
+			onChange()
+		}
+	}
+	go func() {
+		for {
+			select {
+			case _, ok := <-addrUpdates:
+				if !ok {
+					return
+				}
+				sync()
+			case update, ok := <-routeUpdates:
+				if !ok {
+					return
+				}
+				// Only default routes of the main table; the setups' own tables change on every sync.
+				if update.Table == unix.RT_TABLE_MAIN && (update.Dst == nil || update.Dst.IP.IsUnspecified()) {
+					sync()
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// interfaceAddress returns the first IPv4 address of an interface in CIDR form.
+func interfaceAddress(namespace, name string) (string, error) {
+	h, err := handleFor(namespace)
+	if err != nil {
+		return "", err
+	}
+	defer h.Close()
+	link, err := h.LinkByName(name)
+	if err != nil {
+		return "", fmt.Errorf("could not find interface %s: %w", name, err)
+	}
+	addrs, err := h.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return "", fmt.Errorf("could not list addresses of %s: %w", name, err)
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("%s has no IPv4 address", name)
+	}
+	return addrs[0].IPNet.String(), nil
+}
+
+// interfaceGateway returns the gateway of the main table's default route
+// through an interface, which is usually the one DHCP set up.
+func interfaceGateway(namespace, name string) string {
+	h, err := handleFor(namespace)
+	if err != nil {
+		return ""
+	}
+	defer h.Close()
+	link, err := h.LinkByName(name)
+	if err != nil {
+		return ""
+	}
+	routes, err := h.RouteList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return ""
+	}
+	for _, r := range routes {
+		if (r.Dst == nil || r.Dst.IP.IsUnspecified()) && r.Gw != nil {
+			return r.Gw.String()
+		}
+	}
+	return ""
+}
+
+// modifySourceRoutes does a read-modify-write of the saved setups while holding the
+// store's lock. The file is left alone when modify fails.
+func modifySourceRoutes(modify func(setups []SourceRoute) ([]SourceRoute, error)) error {
+	dir := StoreDir()
+	return withStoreLock(dir, func() error {
+		setups, err := LoadSourceRoutes()
+		if err != nil {
+			return err
+		}
+		if setups, err = modify(setups); err != nil {
+			return err
+		}
+		return saveSourceRoutes(setups)
+	})
+}
+
+// saveSourceRoutes overwrites source_routes.json with the given setups.
+// The caller holds the store's lock.
+func saveSourceRoutes(setups []SourceRoute) error {
+	data, err := json.MarshalIndent(setups, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFile(StoreDir(), sourceRoutesFile, data)
+}
+
+// LoadSourceRoutes reads the saved source routing setups.
+func LoadSourceRoutes() ([]SourceRoute, error) {
+	data, err := readStoreFile(StoreDir(), sourceRoutesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SourceRoute{}, nil
+		}
+		return nil, err
+	}
+
+	var setups []SourceRoute
+	if err = json.Unmarshal(data, &setups); err != nil {
+		return nil, err
+	}
+	return setups, nil
+}
+
+// ConfigureSourceRoutes makes the given setups the saved ones of a namespace: new and
+// changed setups are applied, setups that are no longer wanted are removed from the
+// system. Setups of other namespaces stay as they are. Everything that worked is saved
+// in one write, even if some interfaces failed.
+func ConfigureSourceRoutes(namespace string, wanted []SourceRoute) error {
+	sourceSyncMu.Lock()
+	defer sourceSyncMu.Unlock()
+
+	// 1. CHANGE THE KERNEL
+	saved, err := LoadSourceRoutes()
+	if err != nil {
+		return err
+	}
+	var result []SourceRoute
+	var errs []error
+	for _, old := range saved {
+		if old.Namespace != namespace {
+			continue
+		}
+		i := slices.IndexFunc(wanted, func(s SourceRoute) bool { return s.Interface == old.Interface })
+		if i >= 0 && wanted[i].Gateway == old.Gateway && wanted[i].Table == old.Table {
+			continue // Unchanged, applied again below
+		}
+		if err := RemoveSourceRoute(old); err != nil {
+			errs = append(errs, err)
+			if i < 0 {
+				result = append(result, old) // Keep it, so the user can try again
+			}
+		}
+	}
+	for _, s := range wanted {
+		s.Namespace = namespace
+		if address, err := interfaceAddress(namespace, s.Interface); err == nil {
+			s.Address = address
+		}
+		if err := ApplySourceRoute(s); err != nil {
+			errs = append(errs, err)
+			if s.ID != "" {
+				result = append(result, s) // Was saved before, an interface that is down shouldn't lose it
+			}
+			continue
+		}
+		if s.ID == "" {
+			s.ID = newRouteID()
+			s.CreatedAt = time.Now()
+		}
+		result = append(result, s)
+	}
+
+	// 2. SAVE THE SETUPS OF THE NAMESPACE
+	err = modifySourceRoutes(func(setups []SourceRoute) ([]SourceRoute, error) {
+		setups = slices.DeleteFunc(setups, func(s SourceRoute) bool { return s.Namespace == namespace })
+		return append(setups, result...), nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(wanted) > 0 {
+		if err := watchSourceNamespace(namespace); err != nil {
+			log.Printf("WARN: Source routing in %s won't follow address changes: %v", namespace, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+package routemanager
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// inTestNamespace moves the test into a network namespace of its own, so it can change
+// routes and rules without touching the host. Tests that can't create one are skipped.
+func inTestNamespace(t *testing.T) {
+	t.Helper()
+	// Never unlocked: if restoring fails, the thread dies with the test instead of
+	// running other goroutines in the wrong namespace.
+	runtime.LockOSThread()
+	host, err := netns.Get()
+	if err != nil {
+		t.Skipf("no network namespaces here: %v", err)
+	}
+	ns, err := netns.New()
+	if err != nil {
+		host.Close()
+		t.Skipf("could not create a network namespace: %v", err)
+	}
+	t.Cleanup(func() {
+		netns.Set(host)
+		ns.Close()
+		host.Close()
+	})
+}
+
+// addTestInterface creates an interface that is up and has the given address. It is
+// one end of a veth pair, since not every kernel has dummy interfaces.
+func addTestInterface(t *testing.T, name, address string) {
+	t.Helper()
+	link := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: name}, PeerName: name + "p"}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Skipf("could not add %s: %v", name, err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := netlink.ParseAddr(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countRules counts the rules that match rule, whatever their priority.
+func countRules(t *testing.T, rule Rule) int {
+	t.Helper()
+	rule.Priority = 0
+	live, err := ListRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, s := range live {
+		if rule.Matches(s) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestApplySourceRouteTwiceLeavesOneRule(t *testing.T) {
+	inTestNamespace(t)
+	addTestInterface(t, "srctest0", "192.0.2.10/24")
+	setup := SourceRoute{Interface: "srctest0", Gateway: "192.0.2.1", Table: 100, Address: "192.0.2.10/24"}
+	rule, _ := setup.Rule()
+
+	for i := 0; i < 2; i++ {
+		if err := ApplySourceRoute(setup); err != nil {
+			t.Fatalf("apply %d: %v", i+1, err)
+		}
+	}
+	if n := countRules(t, rule); n != 1 {
+		t.Fatalf("%d rules after applying twice, want 1", n)
+	}
+
+	// Older versions added the rule without a priority, which the kernel filled in.
+	old := rule
+	old.Priority = 0
+	if err := AddRule(old); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplySourceRoute(setup); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRules(t, rule); n != 1 {
+		t.Fatalf("%d rules after applying over an old copy, want 1", n)
+	}
+
+	if err := AddRule(old); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveSourceRoute(setup); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRules(t, rule); n != 0 {
+		t.Fatalf("%d rules left after removing the setup, want 0", n)
+	}
+}
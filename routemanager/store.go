@@ -1,26 +1,77 @@
 package routemanager
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"time"
 )
 
 const routesFile = "routes.json"
 
-// SaveRoutes writes a slice of StaticRoute structs to the JSON file.
+// errNotInStore makes modifySavedRoute look for a route in the next store.
+var errNotInStore = errors.New("not in this store")
+
+var (
+	// ErrRouteNotFound is returned when no saved route has the requested ID.
+	ErrRouteNotFound = errors.New("saved route not found")
+	// ErrDuplicateRoute is returned when an update would make two saved routes identical.
+	ErrDuplicateRoute = errors.New("an identical route is already saved")
+)
+
+// SaveRoutes writes a slice of StaticRoute structs to the JSON file of the user's store.
 // This is the low-level function that overwrites the file.
 func SaveRoutes(routes []StaticRoute) error {
-	data, err := json.MarshalIndent(routes, "", "  ")
+	dir := StoreDir()
+	return withStoreLock(dir, func() error { return saveRoutesIn(dir, routes) })
+}
+
+// saveRoutesIn writes the routes of one store. The caller holds its lock.
+func saveRoutesIn(dir string, routes []StaticRoute) error {
+	if routes == nil {
+		routes = []StaticRoute{}
+	}
+	data, err := json.MarshalIndent(routesEnvelope{Version: routesFormat, Routes: routes}, "", "  ")
 	if err != nil {
 		return err
 	}
-	// 0644 are standard file permissions (read/write for owner, read-only for others).
-	return os.WriteFile(routesFile, data, 0644)
+	return writeStoreFile(dir, routesFile, data)
 }
 
-// LoadRoutes reads all routes from the JSON file.
+// LoadRoutes reads the routes of the user's store followed by the system-wide ones,
+// each with its Source. System-wide routes that can't be read are left out with a
+// warning rather than hiding the user's own. Loading only writes to restore a corrupt
+// file of the user's store from its backup, see recoverStoreFile; the system-wide store,
+// which a normal user may only read, is never written.
 func LoadRoutes() ([]StaticRoute, error) {
-	data, err := os.ReadFile(routesFile)
+	var all []StaticRoute
+	for i, dir := range storeDirs() {
+		routes, err := loadRoutesIn(dir)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			log.Printf("WARN: Could not read the routes in %s: %v", dir, err)
+			continue
+		}
+		all = append(all, routes...)
+	}
+	return all, nil
+}
+
+// loadRoutesIn reads the routes of one store. Routes saved by older versions may
+// have no ID, a non-normalized CIDR or a duplicate; they are tidied up in memory
+// and written that way on the next save of the store.
+func loadRoutesIn(dir string) ([]StaticRoute, error) {
+	data, err := readStoreFile(dir, routesFile)
 	if err != nil {
 		// If the file simply doesn't exist, that's not a critical error.
 		// It just means no routes have been saved yet. We return an empty list.
@@ -30,50 +81,297 @@ func LoadRoutes() ([]StaticRoute, error) {
 		return nil, err // For any other error (e.g., permissions), return it.
 	}
 
-	var routes []StaticRoute
-	if err = json.Unmarshal(data, &routes); err != nil {
+	// Files of older formats are upgraded here and written in the current one on the
+	// next save; the old file is then kept as the backup.
+	if data, err = migrateRoutes(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, routesFile), err)
+	}
+	var envelope routesEnvelope
+	if err = json.Unmarshal(data, &envelope); err != nil {
 		return nil, err
 	}
+
+	routes := tidyRoutes(envelope.Routes)
+	for i := range routes {
+		routes[i].Source = sourceOf(dir)
+	}
 	return routes, nil
 }
 
 // AppendRoute adds a single new route to the routes.json file.
-// It uses the safe "Read-Modify-Write" pattern.
+// If the same route is already saved, the new metadata is merged into
+// the existing entry instead of storing a second copy.
 func AppendRoute(newRoute StaticRoute) error {
-	// 1. Read
-	routes, err := LoadRoutes()
-	if err != nil {
+	return AppendRoutes([]StaticRoute{newRoute})
+}
+
+// AppendRoutes adds several routes with a single "Read-Modify-Write" of the file.
+// New routes always go to the user's store.
+func AppendRoutes(newRoutes []StaticRoute) error {
+	return modifyRoutes(StoreDir(), func(routes []StaticRoute) ([]StaticRoute, error) {
+		for _, newRoute := range newRoutes {
+			if err := normalizeRoute(&newRoute); err != nil {
+				return nil, err
+			}
+			if i := indexOfSameRoute(routes, newRoute, ""); i >= 0 {
+				mergeMetadata(&routes[i], newRoute)
+				continue
+			}
+
+			newRoute.ID = newRouteID()
+			if newRoute.CreatedAt.IsZero() {
+				newRoute.CreatedAt = time.Now()
+			}
+			routes = append(routes, newRoute)
+		}
+		return routes, nil
+	})
+}
+
+// UpdateRoute replaces the saved route that has the same ID as updated, in the
+// store it is in. The creation time of the original entry is always preserved.
+func UpdateRoute(updated StaticRoute) error {
+	if err := normalizeRoute(&updated); err != nil {
 		return err
 	}
+	return modifySavedRoute(updated.ID, func(routes []StaticRoute, i int) ([]StaticRoute, error) {
+		if indexOfSameRoute(routes, updated, updated.ID) >= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateRoute, updated.Destination)
+		}
+		updated.CreatedAt = routes[i].CreatedAt
+		routes[i] = updated
+		return routes, nil
+	})
+}
+
+// UpdateMatchingRoute rewrites the saved entry describing old, if there is one, so that
+// it describes updated instead. The ID and metadata of the saved entry are kept.
+// It reports whether a saved entry was found.
+func UpdateMatchingRoute(old, updated StaticRoute) (bool, error) {
+	if err := normalizeRoute(&old); err != nil {
+		return false, err
+	}
+	found := false
+	for _, dir := range storeDirs() {
+		err := modifyRoutes(dir, func(routes []StaticRoute) ([]StaticRoute, error) {
+			// A live route only knows its interface by name, so compare against the
+			// saved routes as they resolve right now.
+			i := slices.IndexFunc(ResolveBindings(routes), func(r StaticRoute) bool {
+				r.Bind = ""
+				return r.SameRoute(old)
+			})
+			if i < 0 {
+				return nil, errNotInStore
+			}
+			found = true
 
-	// 2. Modify
-	routes = append(routes, newRoute)
+			saved := routes[i]
+			if mode, _ := ParseBinding(saved.Bind); mode != BindByName && updated.Interface != old.Interface {
+				// Moved to another card: follow that one the same way.
+				var err error
+				if saved.Bind, err = BindingFor(updated.Interface, mode); err != nil {
+					log.Printf("WARN: Saved route %s is no longer bound: %v", saved.Destination, err)
+				}
+			}
+			saved.Type = updated.Type
+			saved.Destination = updated.Destination
+			saved.Interface = updated.Interface
+			saved.Gateway = updated.Gateway
+			saved.OnLink = updated.OnLink
+			saved.NextHops = updated.NextHops
+			saved.Metric = updated.Metric
+			saved.Src = updated.Src
+			saved.Table = updated.Table
+			saved.PathAttributes = updated.PathAttributes
+			if err := normalizeRoute(&saved); err != nil {
+				return nil, err
+			}
+			if indexOfSameRoute(routes, saved, saved.ID) >= 0 {
+				return nil, fmt.Errorf("%w: %s", ErrDuplicateRoute, saved.Destination)
+			}
+			routes[i] = saved
+			return routes, nil
+		})
+		if !errors.Is(err, errNotInStore) {
+			return found, err
+		}
+	}
+	return false, nil
+}
 
-	// 3. Write
-	return SaveRoutes(routes)
+// DeleteRoute removes the saved route with the given ID from the routes.json file
+// of its store. It also uses the "Read-Modify-Write" pattern.
+func DeleteRoute(id string) error {
+	return modifySavedRoute(id, func(routes []StaticRoute, i int) ([]StaticRoute, error) {
+		// Create a new slice containing only the routes we want to keep.
+		return append(routes[:i:i], routes[i+1:]...), nil
+	})
 }
 
-// DeleteRoute removes a specific route from the routes.json file.
-// It also uses the "Read-Modify-Write" pattern.
-func DeleteRoute(routeToDelete StaticRoute) error {
-	// 1. Read
-	routes, err := LoadRoutes()
-	if err != nil {
+// MarkApplied records the current time as the last time a saved route was applied.
+// Routes that were never saved are silently ignored.
+func MarkApplied(applied StaticRoute) error {
+	mark := func(routes []StaticRoute, i int) ([]StaticRoute, error) {
+		routes[i].LastAppliedAt = time.Now()
+		return routes, nil
+	}
+	err := modifySavedRoute(applied.ID, mark)
+	if !errors.Is(err, ErrRouteNotFound) {
 		return err
 	}
 
-	// 2. Modify: Create a new slice containing only the routes we want to keep.
-	var updatedRoutes []StaticRoute
+	// Applied from the form or the live table: look for the same route instead.
+	if err := normalizeRoute(&applied); err != nil {
+		return nil
+	}
+	for _, dir := range storeDirs() {
+		err := modifyRoutes(dir, func(routes []StaticRoute) ([]StaticRoute, error) {
+			i := indexOfSameRoute(routes, applied, "")
+			if i < 0 {
+				return nil, errNotInStore
+			}
+			return mark(routes, i)
+		})
+		if !errors.Is(err, errNotInStore) {
+			return err
+		}
+	}
+	return nil
+}
+
+// modifyRoutes does a read-modify-write of the routes of one store while holding its
+// lock. The file is left alone when modify fails.
+func modifyRoutes(dir string, modify func(routes []StaticRoute) ([]StaticRoute, error)) error {
+	return withStoreLock(dir, func() error {
+		routes, err := loadRoutesIn(dir)
+		if err != nil {
+			return err
+		}
+		if routes, err = modify(routes); err != nil {
+			return err
+		}
+		return saveRoutesIn(dir, routes)
+	})
+}
+
+// modifySavedRoute is modifyRoutes on the store holding the route with the given ID.
+// modify gets the index of that route.
+func modifySavedRoute(id string, modify func(routes []StaticRoute, i int) ([]StaticRoute, error)) error {
+	for _, dir := range storeDirs() {
+		err := modifyRoutes(dir, func(routes []StaticRoute) ([]StaticRoute, error) {
+			i := indexOfID(routes, id)
+			if i < 0 {
+				return nil, errNotInStore
+			}
+			return modify(routes, i)
+		})
+		if !errors.Is(err, errNotInStore) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrRouteNotFound, id)
+}
+
+// NormalizeCIDR returns the canonical network form of a CIDR,
+// e.g. "10.0.0.5/24" becomes "10.0.0.0/24".
+func NormalizeCIDR(cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination CIDR %s: %w", cidr, err)
+	}
+	return ipNet.String(), nil
+}
+
+// tidyRoutes assigns missing IDs, normalizes destinations and merges duplicates.
+func tidyRoutes(routes []StaticRoute) []StaticRoute {
+	tidy := make([]StaticRoute, 0, len(routes))
 	for _, route := range routes {
-		// This checks if the current route is the one we want to delete.
-		if route.Interface == routeToDelete.Interface &&
-			route.Destination == routeToDelete.Destination &&
-			route.Gateway == routeToDelete.Gateway {
-			continue // Skip adding it to the new slice
+		// An invalid destination can't be fixed here; keep it so the user can see and delete it.
+		_ = normalizeRoute(&route)
+		if route.ID == "" {
+			route.ID = contentRouteID(route)
 		}
-		updatedRoutes = append(updatedRoutes, route)
+		if i := indexOfSameRoute(tidy, route, ""); i >= 0 {
+			mergeMetadata(&tidy[i], route)
+			continue
+		}
+		tidy = append(tidy, route)
 	}
+	return tidy
+}
 
-	// 3. Write
-	return SaveRoutes(updatedRoutes)
+// contentRouteID derives the ID of a route saved without one from what it says, so it
+// gets the same ID on every load until a save of its store records it.
+func contentRouteID(route StaticRoute) string {
+	data, err := json.Marshal(route)
+	if err != nil {
+		return newRouteID()
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func normalizeRoute(route *StaticRoute) error {
+	dst, err := NormalizeCIDR(route.Destination)
+	if err != nil {
+		return err
+	}
+	route.Destination = dst
+	// The main table is stored as 0 so that routes.json stays short and comparable.
+	if route.Table == MainTable {
+		route.Table = 0
+	}
+	return nil
+}
+
+// indexOfSameRoute finds a saved route describing the same kernel route,
+// ignoring the entry with the skipID (used when updating in place).
+func indexOfSameRoute(routes []StaticRoute, route StaticRoute, skipID string) int {
+	for i, r := range routes {
+		if r.ID != skipID && r.SameRoute(route) {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfID(routes []StaticRoute, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, r := range routes {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergeMetadata copies the metadata of a duplicate into an existing entry
+// without losing anything the user already wrote there.
+func mergeMetadata(existing *StaticRoute, duplicate StaticRoute) {
+	if existing.Description == "" {
+		existing.Description = duplicate.Description
+	}
+	for _, tag := range duplicate.Tags {
+		if !slices.Contains(existing.Tags, tag) {
+			existing.Tags = append(existing.Tags, tag)
+		}
+	}
+	if existing.CreatedAt.IsZero() {
+		existing.CreatedAt = duplicate.CreatedAt
+	}
+	if duplicate.LastAppliedAt.After(existing.LastAppliedAt) {
+		existing.LastAppliedAt = duplicate.LastAppliedAt
+	}
+}
+
+// newRouteID returns a random identifier for a saved route.
+func newRouteID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on Linux; fall back to the clock just in case.
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
 }
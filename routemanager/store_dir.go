@@ -0,0 +1,93 @@
+package routemanager
+
+import (
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// StoreEnv names the environment variable that sets where saved data is kept.
+const StoreEnv = "ROUTE_MANAGER_STORE"
+
+// SystemStoreDir holds the routes an administrator saved for every user of the machine.
+// They are listed together with the user's own.
+const SystemStoreDir = "/etc/route-manager"
+
+// StoreSource tells which store a saved route belongs to.
+type StoreSource string
+
+const (
+	SourceUser   StoreSource = "user"
+	SourceSystem StoreSource = "system"
+)
+
+var (
+	storeMu  sync.Mutex
+	storeDir string // Guarded by storeMu, resolved on first use
+	// The user who ran sudo, so the files in their store stay theirs. -1 when not under sudo.
+	storeUID, storeGID = -1, -1
+)
+
+// SetStoreDir makes dir the store, e.g. from a command-line flag. It wins over StoreEnv.
+func SetStoreDir(dir string) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	storeDir, storeUID, storeGID = filepath.Clean(dir), -1, -1
+}
+
+// StoreDir returns the directory saved data is read from and written to: the one given
+// to SetStoreDir, else $ROUTE_MANAGER_STORE, else route-manager in the XDG config
+// directory of the user. Under sudo that is the user who ran sudo, not root.
+func StoreDir() string {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if storeDir == "" {
+		storeDir, storeUID, storeGID = resolveStoreDir()
+	}
+	return storeDir
+}
+
+func resolveStoreDir() (dir string, uid, gid int) {
+	if dir := os.Getenv(StoreEnv); dir != "" {
+		return filepath.Clean(dir), -1, -1
+	}
+	if name := os.Getenv("SUDO_USER"); name != "" && os.Geteuid() == 0 {
+		u, err := user.Lookup(name)
+		if err == nil {
+			uid, _ = strconv.Atoi(u.Uid)
+			gid, _ = strconv.Atoi(u.Gid)
+			// sudo resets the environment, so XDG_CONFIG_HOME is only there if it was kept on purpose.
+			config := os.Getenv("XDG_CONFIG_HOME")
+			if config == "" {
+				config = filepath.Join(u.HomeDir, ".config")
+			}
+			return filepath.Join(config, "route-manager"), uid, gid
+		}
+		log.Printf("WARN: Could not look up %s, who ran sudo: %v", name, err)
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		log.Printf("WARN: No config directory, saving to the working directory: %v", err)
+		return ".", -1, -1
+	}
+	return filepath.Join(config, "route-manager"), -1, -1
+}
+
+// storeDirs lists the stores saved routes are loaded from, the user's first.
+func storeDirs() []string {
+	if dir := StoreDir(); dir != SystemStoreDir {
+		return []string{dir, SystemStoreDir}
+	}
+	return []string{SystemStoreDir}
+}
+
+// sourceOf tells whether a store directory is the system-wide one.
+func sourceOf(dir string) StoreSource {
+	if dir == SystemStoreDir {
+		return SourceSystem
+	}
+	return SourceUser
+}
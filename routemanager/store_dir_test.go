@@ -0,0 +1,133 @@
+package routemanager
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// resetStoreDir forgets the resolved store, so the test resolves it again.
+func resetStoreDir(t *testing.T) {
+	t.Helper()
+	inTestStore(t) // Restores the store afterwards
+	storeMu.Lock()
+	storeDir, storeUID, storeGID = "", -1, -1
+	storeMu.Unlock()
+}
+
+func TestStoreDirOrder(t *testing.T) {
+	tmp := t.TempDir()
+	flagDir := filepath.Join(tmp, "flag")
+	envDir := filepath.Join(tmp, "env")
+	config := filepath.Join(tmp, "config")
+
+	tests := []struct {
+		name   string
+		flag   string
+		env    string
+		sudo   string
+		config string
+		want   string
+	}{
+		{"flag wins", flagDir, envDir, "", config, flagDir},
+		{"flag cleaned", flagDir + "/", "", "", config, flagDir},
+		{"environment", "", envDir, "", config, envDir},
+		{"environment over sudo", "", envDir, "root", config, envDir},
+		{"XDG config", "", "", "", config, filepath.Join(config, "route-manager")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetStoreDir(t)
+			t.Setenv(StoreEnv, tt.env)
+			t.Setenv("SUDO_USER", tt.sudo)
+			t.Setenv("XDG_CONFIG_HOME", tt.config)
+			if tt.flag != "" {
+				SetStoreDir(tt.flag)
+			}
+			if got := StoreDir(); got != tt.want {
+				t.Errorf("StoreDir() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Under sudo the store is the one of the user who ran it, and their files stay theirs.
+func TestStoreDirUnderSudo(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root, like sudo")
+	}
+	// Preferably someone other than root, whose home isn't root's.
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		if u, err = user.Current(); err != nil {
+			t.Skip(err)
+		}
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+
+	t.Run("home of the user", func(t *testing.T) {
+		resetStoreDir(t)
+		t.Setenv(StoreEnv, "")
+		t.Setenv("SUDO_USER", u.Username)
+		t.Setenv("XDG_CONFIG_HOME", "")
+		want := filepath.Join(u.HomeDir, ".config", "route-manager")
+		if got := StoreDir(); got != want {
+			t.Errorf("StoreDir() = %s, want %s", got, want)
+		}
+		storeMu.Lock()
+		gotUID, gotGID := storeUID, storeGID
+		storeMu.Unlock()
+		if gotUID != uid || gotGID != gid {
+			t.Errorf("files are handed to %d:%d, want %d:%d", gotUID, gotGID, uid, gid)
+		}
+	})
+
+	t.Run("kept XDG config", func(t *testing.T) {
+		resetStoreDir(t)
+		config := t.TempDir()
+		t.Setenv(StoreEnv, "")
+		t.Setenv("SUDO_USER", u.Username)
+		t.Setenv("XDG_CONFIG_HOME", config)
+		if got, want := StoreDir(), filepath.Join(config, "route-manager"); got != want {
+			t.Errorf("StoreDir() = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		resetStoreDir(t)
+		config := t.TempDir()
+		t.Setenv(StoreEnv, "")
+		t.Setenv("SUDO_USER", "nosuchuser-route-manager")
+		t.Setenv("XDG_CONFIG_HOME", config)
+		if got, want := StoreDir(), filepath.Join(config, "route-manager"); got != want {
+			t.Errorf("StoreDir() = %s, want %s", got, want)
+		}
+		storeMu.Lock()
+		gotUID := storeUID
+		storeMu.Unlock()
+		if gotUID != -1 {
+			t.Errorf("files are handed to uid %d, want them left alone", gotUID)
+		}
+	})
+}
+
+func TestStoreDirsListSystemStore(t *testing.T) {
+	resetStoreDir(t)
+	SetStoreDir(t.TempDir())
+	dirs := storeDirs()
+	if len(dirs) != 2 || dirs[0] != StoreDir() || dirs[1] != SystemStoreDir {
+		t.Errorf("storeDirs() = %q, want the user's store, then %s", dirs, SystemStoreDir)
+	}
+	if sourceOf(dirs[0]) != SourceUser || sourceOf(dirs[1]) != SourceSystem {
+		t.Errorf("sources %s, %s", sourceOf(dirs[0]), sourceOf(dirs[1]))
+	}
+
+	// An administrator using the system-wide store as their own only has that one.
+	SetStoreDir(SystemStoreDir)
+	if dirs := storeDirs(); len(dirs) != 1 || dirs[0] != SystemStoreDir {
+		t.Errorf("storeDirs() = %q, want only %s", dirs, SystemStoreDir)
+	}
+}
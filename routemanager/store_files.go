@@ -0,0 +1,218 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Store files are replaced atomically, so a crash leaves the old or the new version but
+// never half of one. The version before each write is kept as a .bak next to the file,
+// and a file that is corrupt anyway (a full disk, a hand edit) is replaced by it.
+
+// lockFile is locked with flock around every read-modify-write of a store, so the GUI
+// and a command running at the same time don't overwrite each other's changes.
+const lockFile = ".lock"
+
+// backupSuffix names the copy of the previous version of a store file.
+const backupSuffix = ".bak"
+
+// readStoreFile reads a file of a store. Older versions kept their files in the working
+// directory; such a file is still read until the store has a copy of its own.
+// A corrupt file is restored from its backup, see recoverStoreFile.
+func readStoreFile(dir, name string) ([]byte, error) {
+	path := filepath.Join(dir, name)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && dir == StoreDir() {
+		if legacy, legacyErr := os.ReadFile(name); legacyErr == nil {
+			log.Printf("Read %s from the working directory, it moves to %s when saved", name, dir)
+			path, data, err = name, legacy, nil
+		}
+	}
+	if err != nil || json.Valid(data) {
+		return data, err
+	}
+	return recoverStoreFile(dir, path)
+}
+
+// recoverStoreFile returns the backup of a corrupt store file. In the user's store the
+// backup is also put in its place, while holding the store's lock. If the lock is taken,
+// possibly by a read-modify-write of this very process, that is left to the holder: its
+// write replaces the corrupt file. The system-wide store and files outside the store are
+// only read.
+func recoverStoreFile(dir, path string) ([]byte, error) {
+	backup, err := os.ReadFile(path + backupSuffix)
+	if err != nil || !json.Valid(backup) {
+		return nil, fmt.Errorf("%s is corrupt and has no usable backup", path)
+	}
+	if dir != StoreDir() || filepath.Dir(path) != dir {
+		log.Printf("WARN: %s is corrupt, using %s%s instead", path, path, backupSuffix)
+		return backup, nil
+	}
+
+	locked, err := tryStoreLock(dir, func() error {
+		// Someone else may have fixed it while we waited for the lock.
+		if data, err := os.ReadFile(path); err == nil && json.Valid(data) {
+			backup = data
+			return nil
+		}
+		corrupt, err := moveAside(path)
+		if err != nil {
+			return fmt.Errorf("%s is corrupt and could not be moved aside: %w", path, err)
+		}
+		if err := writeAtomic(path, backup); err != nil {
+			return fmt.Errorf("%s is corrupt and could not be restored: %w", path, err)
+		}
+		if err := chownToStoreOwner(dir, path, corrupt); err != nil {
+			log.Printf("WARN: Could not hand %s back to its owner: %v", path, err)
+		}
+		log.Printf("WARN: %s was corrupt and was restored from %s%s; the corrupt file is %s", path, path, backupSuffix, corrupt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		log.Printf("WARN: %s is corrupt, using %s%s until it is saved again", path, path, backupSuffix)
+	}
+	return backup, nil
+}
+
+// moveAside renames a corrupt store file, so nothing the user might still need is lost.
+// It returns the new name.
+func moveAside(path string) (string, error) {
+	corrupt := path + ".corrupt-" + time.Now().Format("20060102-150405")
+	return corrupt, os.Rename(path, corrupt)
+}
+
+// writeStoreFile writes a file of a store, creating the directory first if needed.
+// The previous version becomes the backup; a corrupt one is moved aside instead.
+// The caller holds the store's lock.
+func writeStoreFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	corrupt := ""
+	if previous, err := os.ReadFile(path); err == nil {
+		if json.Valid(previous) {
+			if err := writeAtomic(path+backupSuffix, previous); err != nil {
+				return fmt.Errorf("could not back up %s: %w", path, err)
+			}
+		} else if corrupt, err = moveAside(path); err != nil {
+			return fmt.Errorf("%s is corrupt and could not be moved aside: %w", path, err)
+		} else {
+			log.Printf("WARN: %s was corrupt and was replaced; the corrupt file is %s", path, corrupt)
+		}
+	}
+	if err := writeAtomic(path, data); err != nil {
+		return err
+	}
+	if corrupt != "" {
+		return chownToStoreOwner(dir, path, path+backupSuffix, corrupt)
+	}
+	return chownToStoreOwner(dir, path, path+backupSuffix)
+}
+
+// writeAtomic replaces a file by writing a temporary file next to it, flushing it to
+// disk and renaming it over the old one.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// 0644 are standard file permissions (read/write for owner, read-only for others).
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// The rename only survives a crash once the directory is flushed too.
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// withStoreLock runs fn while holding the lock of a store. The user's store is created
+// on first use; a system-wide store that doesn't exist, or that this process can't
+// write to, isn't locked: fn can't change it either and fails on its own if it tries.
+func withStoreLock(dir string, fn func() error) error {
+	_, err := lockStore(dir, unix.LOCK_EX, fn)
+	return err
+}
+
+// tryStoreLock is withStoreLock without waiting: if the lock is taken, by another
+// process or this one, fn isn't run. It reports whether fn ran.
+func tryStoreLock(dir string, fn func() error) (bool, error) {
+	return lockStore(dir, unix.LOCK_EX|unix.LOCK_NB, fn)
+}
+
+// lockStore runs fn holding the lock of a store, taken with the given flock operation.
+func lockStore(dir string, how int, fn func() error) (bool, error) {
+	if dir == StoreDir() {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return false, err
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return true, fn()
+		}
+		return false, err
+	}
+	defer f.Close() // Closing releases the lock
+
+	if err := unix.Flock(int(f.Fd()), how); err != nil {
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, fmt.Errorf("could not lock %s: %w", dir, err)
+	}
+	if err := chownToStoreOwner(dir, f.Name()); err != nil {
+		log.Printf("WARN: Could not hand %s back to its owner: %v", f.Name(), err)
+	}
+	return true, fn()
+}
+
+// chownToStoreOwner hands the files of the user's store back to the user who ran sudo.
+// Files that don't exist are skipped.
+func chownToStoreOwner(dir string, paths ...string) error {
+	storeMu.Lock()
+	uid, gid, own := storeUID, storeGID, dir == storeDir
+	storeMu.Unlock()
+	if !own || uid < 0 {
+		return nil
+	}
+	for _, path := range append([]string{dir}, paths...) {
+		if err := os.Lchown(path, uid, gid); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
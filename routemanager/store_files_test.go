@@ -0,0 +1,159 @@
+package routemanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// storeEntries lists the names in a store directory, leaving out its lock.
+func storeEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Name() != lockFile {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func TestWriteAtomicLeavesNoTemporaryFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes.json")
+	for _, content := range []string{`{"first":true}`, `{"second":true}`} {
+		if err := writeAtomic(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.ReadFile(path); err != nil || string(got) != content {
+			t.Errorf("read %q, %v, want %q", got, err, content)
+		}
+	}
+	if names := storeEntries(t, dir); len(names) != 1 || names[0] != "routes.json" {
+		t.Errorf("the directory holds %q, want only routes.json", names)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("permissions %v, want 0644", info.Mode().Perm())
+	}
+}
+
+func TestWriteStoreFileKeepsBackup(t *testing.T) {
+	dir := inTestStore(t)
+	path := filepath.Join(dir, routesFile)
+
+	// The first version has nothing to back up.
+	if err := SaveRoutes([]StaticRoute{{Destination: "10.0.0.0/24", Interface: "eth0"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + backupSuffix); !os.IsNotExist(err) {
+		t.Errorf("a backup after the first save: %v", err)
+	}
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AppendRoute(StaticRoute{Destination: "10.1.0.0/24", Interface: "eth0"}); err != nil {
+		t.Fatal(err)
+	}
+	if backup, err := os.ReadFile(path + backupSuffix); err != nil || string(backup) != string(first) {
+		t.Errorf("backup %q, %v, want the previous version %q", backup, err, first)
+	}
+	if n := len(loadTestRoutes(t)); n != 2 {
+		t.Errorf("%d routes saved, want 2", n)
+	}
+	for _, name := range storeEntries(t, dir) {
+		if strings.Contains(name, ".tmp") {
+			t.Errorf("temporary file %s left behind", name)
+		}
+	}
+}
+
+func TestCorruptRoutesRecoveredFromBackup(t *testing.T) {
+	dir := inTestStore(t)
+	path := filepath.Join(dir, routesFile)
+	if err := SaveRoutes([]StaticRoute{{Destination: "10.0.0.0/24", Interface: "eth0"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendRoute(StaticRoute{Destination: "10.1.0.0/24", Interface: "eth0"}); err != nil {
+		t.Fatal(err)
+	}
+	// Half a file, as a full disk leaves it.
+	corrupt := []byte(`{"version": 2, "routes": [{"destinat`)
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := loadTestRoutes(t)
+	if len(routes) != 1 || routes[0].Destination != "10.0.0.0/24" {
+		t.Errorf("loaded %+v, want the route of the backup", routes)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) == string(corrupt) {
+		t.Errorf("routes.json was not restored: %q, %v", data, err)
+	}
+	var kept []string
+	for _, name := range storeEntries(t, dir) {
+		if strings.HasPrefix(name, routesFile+".corrupt-") {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) != 1 {
+		t.Fatalf("corrupt files %q, want the one moved aside", kept)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, kept[0])); err != nil || string(data) != string(corrupt) {
+		t.Errorf("%s holds %q, %v, want the corrupt file", kept[0], data, err)
+	}
+
+	// Without a usable backup there is nothing to recover.
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+backupSuffix, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRoutes(); err == nil {
+		t.Error("loaded a corrupt file without a usable backup")
+	}
+}
+
+func TestConcurrentAppendsAllSurvive(t *testing.T) {
+	inTestStore(t)
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- AppendRoutes([]StaticRoute{{Destination: fmt.Sprintf("10.%d.0.0/16", i), Interface: "eth0"}})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	saved := map[string]bool{}
+	for _, r := range loadTestRoutes(t) {
+		saved[r.Destination] = true
+	}
+	for i := range n {
+		if destination := fmt.Sprintf("10.%d.0.0/16", i); !saved[destination] {
+			t.Errorf("%s was lost", destination)
+		}
+	}
+}
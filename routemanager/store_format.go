@@ -0,0 +1,86 @@
+package routemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// routesFormat is the version of routes.json this build writes. Version 1 is the bare
+// array of routes that older builds wrote; since version 2 the routes are wrapped in an
+// envelope that carries the version, so settings and new fields have somewhere to go.
+const routesFormat = 2
+
+// ErrNewerFormat is returned for a routes.json written by a newer build. Reading it could
+// drop what this build doesn't know about, and saving would then lose it for good.
+var ErrNewerFormat = errors.New("saved by a newer version of route-manager")
+
+// routesEnvelope is routes.json from version 2 on.
+type routesEnvelope struct {
+	Version int           `json:"version"`
+	Routes  []StaticRoute `json:"routes"`
+}
+
+// migration upgrades the data of routes.json by one version.
+type migration func(data []byte) ([]byte, error)
+
+// routesMigrations[i] upgrades version i+1 to version i+2. Every new version adds one,
+// along with its golden files in testdata/migrations, and never changes an older one:
+// files of every version may still be around.
+var routesMigrations = []migration{
+	wrapRoutes, // 1 → 2
+}
+
+// migrateRoutes brings the data of routes.json up to routesFormat.
+func migrateRoutes(data []byte) ([]byte, error) {
+	version, err := routesVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	if version > routesFormat {
+		return nil, fmt.Errorf("format version %d is %w, this one reads up to version %d",
+			version, ErrNewerFormat, routesFormat)
+	}
+
+	for ; version < routesFormat; version++ {
+		if data, err = routesMigrations[version-1](data); err != nil {
+			return nil, fmt.Errorf("could not upgrade saved routes from format version %d: %w", version, err)
+		}
+	}
+	return data, nil
+}
+
+// routesVersion tells which version of routes.json the data is. A bare array is version 1.
+func routesVersion(data []byte) (int, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.Equal(trimmed, []byte("null")) {
+		return 1, nil
+	}
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, fmt.Errorf("unknown format of saved routes: %w", err)
+	}
+	if header.Version < 2 {
+		return 0, fmt.Errorf("saved routes have an invalid format version %d", header.Version)
+	}
+	return header.Version, nil
+}
+
+// wrapRoutes puts the bare array of version 1 into the envelope of version 2.
+// The routes themselves are copied as they are.
+func wrapRoutes(data []byte) ([]byte, error) {
+	var routes []json.RawMessage
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, err
+	}
+	if routes == nil {
+		routes = []json.RawMessage{}
+	}
+	return json.MarshalIndent(struct {
+		Version int               `json:"version"`
+		Routes  []json.RawMessage `json:"routes"`
+	}{2, routes}, "", "  ")
+}
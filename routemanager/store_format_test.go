@@ -0,0 +1,139 @@
+package routemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test ./routemanager -run Migration -update rewrites the expected files. Only do that
+// for a new step: the output of an existing one must never change.
+var update = flag.Bool("update", false, "rewrite the golden files of the migrations")
+
+// goldenRoutes names the golden file of routes.json in the given format version.
+func goldenRoutes(version int) string {
+	return filepath.Join("testdata", "migrations", fmt.Sprintf("routes_v%d.json", version))
+}
+
+// TestRoutesMigrationSteps runs every migration on the golden file of the version it
+// upgrades from and compares the result with the golden file of the next version.
+func TestRoutesMigrationSteps(t *testing.T) {
+	if len(routesMigrations) != routesFormat-1 {
+		t.Fatalf("%d migrations for format version %d", len(routesMigrations), routesFormat)
+	}
+	for i, migrate := range routesMigrations {
+		from, to := i+1, i+2
+		t.Run(fmt.Sprintf("v%d-v%d", from, to), func(t *testing.T) {
+			input, err := os.ReadFile(goldenRoutes(from))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := migrate(input)
+			if err != nil {
+				t.Fatalf("migrating %s: %v", goldenRoutes(from), err)
+			}
+			got = append(got, '\n')
+
+			if *update {
+				if err := os.WriteFile(goldenRoutes(to), got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(goldenRoutes(to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("migrating %s gave\n%s\nwant %s:\n%s", goldenRoutes(from), got, goldenRoutes(to), want)
+			}
+			if version, err := routesVersion(got); err != nil || version != to {
+				t.Errorf("migrating %s gave format version %d (%v), want %d", goldenRoutes(from), version, err, to)
+			}
+		})
+	}
+}
+
+// TestMigrateRoutes upgrades the golden file of every version to the current format,
+// which must keep all the routes of the oldest one.
+func TestMigrateRoutes(t *testing.T) {
+	var oldest []StaticRoute
+	input, err := os.ReadFile(goldenRoutes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(input, &oldest); err != nil {
+		t.Fatal(err)
+	}
+
+	for version := 1; version <= routesFormat; version++ {
+		input, err := os.ReadFile(goldenRoutes(version))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := migrateRoutes(input)
+		if err != nil {
+			t.Fatalf("migrating %s: %v", goldenRoutes(version), err)
+		}
+		var envelope routesEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			t.Fatalf("migrating %s: %v", goldenRoutes(version), err)
+		}
+		if envelope.Version != routesFormat {
+			t.Errorf("migrating %s gave format version %d, want %d", goldenRoutes(version), envelope.Version, routesFormat)
+		}
+		got, _ := json.Marshal(envelope.Routes)
+		want, _ := json.Marshal(oldest)
+		if !bytes.Equal(got, want) {
+			t.Errorf("migrating %s gave routes\n%s\nwant\n%s", goldenRoutes(version), got, want)
+		}
+	}
+}
+
+func TestMigrateRoutesRefusesNewerFormat(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "migrations", "routes_newer.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrateRoutes(input); !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("got %v, want %v", err, ErrNewerFormat)
+	}
+}
+
+// Loading tidies up an old file in memory only: the system-wide store is read by users
+// who can't write it. Routes without an ID get the same one on every load.
+func TestLoadRoutesLeavesOldFileAlone(t *testing.T) {
+	input, err := os.ReadFile(goldenRoutes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, routesFile)
+	if err := os.WriteFile(path, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := loadRoutesIn(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := loadRoutesIn(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, input) {
+		t.Errorf("loading rewrote %s:\n%s", path, data)
+	}
+	if len(first) != 3 || first[0].Destination != "10.8.0.0/24" {
+		t.Fatalf("loaded %+v, want the 3 routes with normalized destinations", first)
+	}
+	for i := range first {
+		if first[i].ID == "" || first[i].ID != again[i].ID {
+			t.Errorf("route %s has ID %q, then %q", first[i].Destination, first[i].ID, again[i].ID)
+		}
+	}
+}
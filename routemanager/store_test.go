@@ -0,0 +1,245 @@
+package routemanager
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// inTestStore makes an empty temporary directory the user's store for the test.
+func inTestStore(t *testing.T) string {
+	t.Helper()
+	storeMu.Lock()
+	dir, uid, gid := storeDir, storeUID, storeGID
+	storeMu.Unlock()
+	t.Cleanup(func() {
+		storeMu.Lock()
+		storeDir, storeUID, storeGID = dir, uid, gid
+		storeMu.Unlock()
+	})
+
+	tmp := t.TempDir()
+	SetStoreDir(tmp)
+	return tmp
+}
+
+// loadTestRoutes loads the routes of the test's store.
+func loadTestRoutes(t *testing.T) []StaticRoute {
+	t.Helper()
+	routes, err := LoadRoutes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+func TestAppendRouteDeduplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []StaticRoute
+		want   []string // The saved routes, as String formats them
+	}{
+		{
+			name: "same route twice",
+			routes: []StaticRoute{
+				{Destination: "10.0.0.0/24", Interface: "eth0", Gateway: "192.168.1.1"},
+				{Destination: "10.0.0.0/24", Interface: "eth0", Gateway: "192.168.1.1"},
+			},
+			want: []string{"10.0.0.0/24 via 192.168.1.1 dev eth0"},
+		},
+		{
+			name: "host bits are dropped",
+			routes: []StaticRoute{
+				{Destination: "10.0.0.0/24", Interface: "eth0"},
+				{Destination: "10.0.0.5/24", Interface: "eth0"},
+			},
+			want: []string{"10.0.0.0/24 dev eth0"},
+		},
+		{
+			name: "main table by number",
+			routes: []StaticRoute{
+				{Destination: "10.0.0.0/24", Interface: "eth0"},
+				{Destination: "10.0.0.0/24", Interface: "eth0", Table: MainTable},
+			},
+			want: []string{"10.0.0.0/24 dev eth0"},
+		},
+		{
+			name: "other prefix length",
+			routes: []StaticRoute{
+				{Destination: "10.0.0.0/24", Interface: "eth0"},
+				{Destination: "10.0.0.0/25", Interface: "eth0"},
+			},
+			want: []string{"10.0.0.0/24 dev eth0", "10.0.0.0/25 dev eth0"},
+		},
+		{
+			name: "other gateway",
+			routes: []StaticRoute{
+				{Destination: "10.0.0.0/24", Interface: "eth0", Gateway: "192.168.1.1"},
+				{Destination: "10.0.0.0/24", Interface: "eth0", Gateway: "192.168.1.2"},
+			},
+			want: []string{"10.0.0.0/24 via 192.168.1.1 dev eth0", "10.0.0.0/24 via 192.168.1.2 dev eth0"},
+		},
+		{
+			name: "other metric",
+			routes: []StaticRoute{
+				{Destination: "10.0.0.0/24", Interface: "eth0"},
+				{Destination: "10.0.0.0/24", Interface: "eth0", Metric: 100},
+			},
+			want: []string{"10.0.0.0/24 dev eth0", "10.0.0.0/24 dev eth0 metric 100"},
+		},
+		{
+			name: "other namespace",
+			routes: []StaticRoute{
+				{Destination: "10.0.0.0/24", Interface: "eth0"},
+				{Destination: "10.0.0.0/24", Interface: "eth0", Namespace: "lab"},
+			},
+			want: []string{"10.0.0.0/24 dev eth0", "10.0.0.0/24 dev eth0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTestStore(t)
+			for _, route := range tt.routes {
+				if err := AppendRoute(route); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var got []string
+			for _, route := range loadTestRoutes(t) {
+				got = append(got, route.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("saved %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendRouteMergesMetadata(t *testing.T) {
+	inTestStore(t)
+	route := StaticRoute{Destination: "10.0.0.0/24", Interface: "eth0", Tags: []string{"office"}}
+	if err := AppendRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	route.Destination = "10.0.0.1/24"
+	route.Description = "Intranet"
+	route.Tags = []string{"office", "vpn"}
+	if err := AppendRoute(route); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := loadTestRoutes(t)
+	if len(routes) != 1 {
+		t.Fatalf("saved %d routes, want 1", len(routes))
+	}
+	if got := routes[0]; got.Description != "Intranet" || !slices.Equal(got.Tags, []string{"office", "vpn"}) {
+		t.Errorf("merged into %q %q, want \"Intranet\" [office vpn]", got.Description, got.Tags)
+	}
+}
+
+func TestRouteIDsAreStable(t *testing.T) {
+	inTestStore(t)
+	err := AppendRoutes([]StaticRoute{
+		{Destination: "10.0.0.0/24", Interface: "eth0"},
+		{Destination: "10.1.0.0/24", Interface: "eth0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := loadTestRoutes(t)
+	if len(first) != 2 || first[0].ID == "" || first[0].ID == first[1].ID {
+		t.Fatalf("saved %+v, want 2 routes with IDs of their own", first)
+	}
+	created := first[0].CreatedAt
+
+	// Saving what was loaded, appending a duplicate and editing keep every ID.
+	if err := SaveRoutes(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendRoute(StaticRoute{Destination: "10.0.0.7/24", Interface: "eth0"}); err != nil {
+		t.Fatal(err)
+	}
+	edited := first[0]
+	edited.Gateway = "192.168.1.1"
+	edited.Description = "Edited"
+	if err := UpdateRoute(edited); err != nil {
+		t.Fatal(err)
+	}
+
+	again := loadTestRoutes(t)
+	if len(again) != 2 {
+		t.Fatalf("saved %d routes, want 2", len(again))
+	}
+	for i := range first {
+		if again[i].ID != first[i].ID {
+			t.Errorf("route %d has ID %q, was %q", i, again[i].ID, first[i].ID)
+		}
+	}
+	if again[0].Gateway != "192.168.1.1" || again[0].Description != "Edited" || !again[0].CreatedAt.Equal(created) {
+		t.Errorf("updated to %+v, want the new gateway and description and the old creation time", again[0])
+	}
+}
+
+func TestUpdateRoute(t *testing.T) {
+	inTestStore(t)
+	err := AppendRoutes([]StaticRoute{
+		{Destination: "10.0.0.0/24", Interface: "eth0"},
+		{Destination: "10.1.0.0/24", Interface: "eth0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := loadTestRoutes(t)
+
+	// Turning one route into the other would save it twice.
+	clash := routes[1]
+	clash.Destination = "10.0.0.9/24"
+	if err := UpdateRoute(clash); !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("updating into a duplicate: %v, want %v", err, ErrDuplicateRoute)
+	}
+
+	missing := routes[0]
+	missing.ID = "nosuchid"
+	if err := UpdateRoute(missing); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("updating an unknown ID: %v, want %v", err, ErrRouteNotFound)
+	}
+
+	// A live route is found by what it describes and keeps the saved ID.
+	live := StaticRoute{Destination: "10.1.0.0/24", Interface: "eth0"}
+	moved := StaticRoute{Destination: "10.2.0.0/24", Interface: "eth1"}
+	found, err := UpdateMatchingRoute(live, moved)
+	if err != nil || !found {
+		t.Fatalf("UpdateMatchingRoute = %v, %v, want true, nil", found, err)
+	}
+	if found, err := UpdateMatchingRoute(live, moved); err != nil || found {
+		t.Errorf("UpdateMatchingRoute of a route that isn't saved = %v, %v, want false, nil", found, err)
+	}
+	got := loadTestRoutes(t)
+	if got[1].ID != routes[1].ID || got[1].String() != "10.2.0.0/24 dev eth1" {
+		t.Errorf("updated to %s with ID %q, want 10.2.0.0/24 dev eth1 with ID %q", got[1], got[1].ID, routes[1].ID)
+	}
+}
+
+func TestDeleteRouteByID(t *testing.T) {
+	inTestStore(t)
+	err := AppendRoutes([]StaticRoute{
+		{Destination: "10.0.0.0/24", Interface: "eth0"},
+		{Destination: "10.0.0.0/24", Interface: "eth1"},
+		{Destination: "10.0.0.0/24", Interface: "eth0", Metric: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := loadTestRoutes(t)
+
+	if err := DeleteRoute(routes[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	got := loadTestRoutes(t)
+	if len(got) != 2 || got[0].ID != routes[0].ID || got[1].ID != routes[2].ID {
+		t.Errorf("left %+v, want the first and the last route", got)
+	}
+	if err := DeleteRoute(routes[1].ID); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("deleting it again: %v, want %v", err, ErrRouteNotFound)
+	}
+}
@@ -1,53 +1,123 @@
 package routemanager
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
+// ListSystemRoutes lists the routes of the current namespace, see SetNamespace.
 func ListSystemRoutes() []SystemRoute {
+	return ListSystemRoutesIn(CurrentNamespace())
+}
+
+// ListSystemRoutesIn lists the IPv4 routes of every table in a network namespace.
+func ListSystemRoutesIn(namespace string) []SystemRoute {
 	var systemRoutes []SystemRoute
 
-	// Passing nil for the link gets all routes on the system.
-	routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	h, err := handleFor(namespace)
+	if err != nil {
+		log.Printf("ERROR: Could not list system routes: %v", err)
+		return systemRoutes
+	}
+	defer h.Close()
+
+	// Tables and VRFs may have come and gone since the last refresh.
+	ReloadTableNames()
+
+	// Filtering by the unspecified table returns the routes of every table,
+	// RouteList on its own only returns the main table.
+	routes, err := h.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: unix.RT_TABLE_UNSPEC}, netlink.RT_FILTER_TABLE)
 	if err != nil {
 		log.Printf("ERROR: Could not list system routes: %v", err)
 		return systemRoutes
 	}
 
 	for _, r := range routes {
-		// Skip routes that don't have a destination
-		if r.Dst == nil {
-			continue
+		// Default routes may come without a destination.
+		destination := "0.0.0.0/0"
+		if r.Dst != nil {
+			destination = r.Dst.String()
 		}
 
 		gateway := ""
 		if r.Gw != nil {
 			gateway = r.Gw.String()
 		}
+		src := ""
+		if r.Src != nil {
+			src = r.Src.String()
+		}
 
-		link, err := netlink.LinkByIndex(r.LinkIndex)
-		if err != nil {
-			log.Printf("WARN: Could not find link for index %d: %v", r.LinkIndex, err)
-			continue
+		// Blackhole and other special routes have no interface.
+		interfaceName := ""
+		if r.LinkIndex > 0 {
+			link, err := h.LinkByIndex(r.LinkIndex)
+			if err != nil {
+				log.Printf("WARN: Could not find link for index %d: %v", r.LinkIndex, err)
+				continue
+			}
+			interfaceName = link.Attrs().Name
+		}
+
+		var nextHops []NextHop
+		for _, hop := range r.MultiPath {
+			nextHops = append(nextHops, systemNextHop(h, hop))
+		}
+
+		routeType := ""
+		if r.Type != unix.RTN_UNICAST {
+			routeType = routeTypeName(r.Type)
 		}
 
 		// The type of r.Protocol is netlink.RouteProtocol, so we pass it directly
 		protocol, isStatic := interpretProtocol(r.Protocol)
 
 		systemRoutes = append(systemRoutes, SystemRoute{
-			Interface:   link.Attrs().Name,
-			Destination: r.Dst.String(),
+			Type:        routeType,
+			Interface:   interfaceName,
+			Destination: destination,
 			Gateway:     gateway,
+			OnLink:      r.Flags&int(netlink.FLAG_ONLINK) != 0,
+			NextHops:    nextHops,
 			Protocol:    protocol,
+			Metric:      r.Priority,
+			Src:         src,
+			Table:       r.Table,
+			Namespace:   namespace,
 			IsStatic:    isStatic,
+			PathAttributes: PathAttributes{
+				MTU:        r.MTU,
+				AdvMSS:     r.AdvMSS,
+				InitCwnd:   r.InitCwnd,
+				InitRwnd:   r.InitRwnd,
+				Congestion: r.Congctl,
+			},
 		})
 	}
 
 	return systemRoutes
 }
 
+// systemNextHop converts one path of a multipath route from the kernel.
+func systemNextHop(h *netlink.Handle, hop *netlink.NexthopInfo) NextHop {
+	nextHop := NextHop{
+		Weight: hop.Hops + 1,
+		OnLink: hop.Flags&int(netlink.FLAG_ONLINK) != 0,
+	}
+	if hop.Gw != nil {
+		nextHop.Gateway = hop.Gw.String()
+	}
+	if link, err := h.LinkByIndex(hop.LinkIndex); err == nil {
+		nextHop.Interface = link.Attrs().Name
+	} else {
+		nextHop.Interface = fmt.Sprintf("if%d", hop.LinkIndex)
+	}
+	return nextHop
+}
+
 func interpretProtocol(p netlink.RouteProtocol) (string, bool) {
 	// These values correspond to the constants defined in Linux's networking headers.
 	const (
@@ -0,0 +1,195 @@
+package routemanager
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// rtTablesFiles are read in order, later files override earlier ones. Newer
+// iproute2 packages ship their defaults under /usr/share and leave /etc for the admin.
+var rtTablesFiles = []string{
+	"/usr/share/iproute2/rt_tables",
+	"/etc/iproute2/rt_tables",
+}
+
+// rtTablesDirs hold drop-in files (*.conf) with more table names.
+var rtTablesDirs = []string{
+	"/usr/share/iproute2/rt_tables.d",
+	"/etc/iproute2/rt_tables.d",
+}
+
+// RoutingTable is a kernel routing table, named by rt_tables or by the VRF device bound to it.
+type RoutingTable struct {
+	ID   int
+	Name string
+	VRF  bool // The table belongs to a VRF device of the same name
+}
+
+var (
+	tablesMu       sync.RWMutex
+	tableNames     map[int]string // Guarded by tablesMu
+	vrfTables      map[int]bool   // Guarded by tablesMu
+	loadTablesOnce sync.Once
+)
+
+// loadTableNames reads the table names the first time one is needed.
+func loadTableNames() {
+	loadTablesOnce.Do(readTableNames)
+}
+
+// IsHiddenTable reports whether a table is hidden from the route list unless asked for.
+// The local table only holds the host's own and broadcast addresses, which nobody edits.
+func IsHiddenTable(table int) bool {
+	return table == unix.RT_TABLE_LOCAL
+}
+
+// ReloadTableNames rereads the table names from rt_tables and the VRF devices,
+// so tables added while the app runs show up by name.
+func ReloadTableNames() {
+	loadTablesOnce.Do(func() {}) // Later lookups must not reload again
+	readTableNames()
+}
+
+// readTableNames does the work of ReloadTableNames. It must not touch loadTablesOnce,
+// since loadTableNames runs it from inside that Once.
+func readTableNames() {
+	// The kernel's own tables are named even without an rt_tables file.
+	names := map[int]string{
+		unix.RT_TABLE_MAIN:    "main",
+		unix.RT_TABLE_LOCAL:   "local",
+		unix.RT_TABLE_DEFAULT: "default",
+	}
+	files := slices.Clone(rtTablesFiles)
+	for _, dir := range rtTablesDirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.conf"))
+		files = append(files, matches...)
+	}
+	for _, file := range files {
+		if err := readRtTables(file, names); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARN: Could not read table names from %s: %v", file, err)
+		}
+	}
+
+	// A VRF's table is best known by the VRF's name, even if rt_tables names it too.
+	vrfs := map[int]bool{}
+	var links []netlink.Link
+	h, err := handleFor(CurrentNamespace())
+	if err == nil {
+		links, err = h.LinkList()
+		h.Close()
+	}
+	if err != nil {
+		log.Printf("WARN: Could not list VRF devices: %v", err)
+	}
+	for _, link := range links {
+		if vrf, ok := link.(*netlink.Vrf); ok {
+			names[int(vrf.Table)] = vrf.Name
+			vrfs[int(vrf.Table)] = true
+		}
+	}
+
+	tablesMu.Lock()
+	tableNames, vrfTables = names, vrfs
+	tablesMu.Unlock()
+}
+
+// readRtTables adds the "<id> <name>" lines of an rt_tables file to names.
+func readRtTables(path string, names map[int]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[0], 0, 32)
+		if err != nil {
+			continue // iproute2 ignores malformed lines too
+		}
+		names[int(id)] = fields[1]
+	}
+	return scanner.Err()
+}
+
+// RoutingTables returns every named table and VRF, main first and the rest by ID.
+func RoutingTables() []RoutingTable {
+	loadTableNames()
+	tablesMu.RLock()
+	defer tablesMu.RUnlock()
+
+	var tables []RoutingTable
+	for id, name := range tableNames {
+		if id == unix.RT_TABLE_UNSPEC {
+			continue
+		}
+		tables = append(tables, RoutingTable{ID: id, Name: name, VRF: vrfTables[id]})
+	}
+	slices.SortFunc(tables, func(a, b RoutingTable) int {
+		return cmp.Compare(tableOrder(a.ID), tableOrder(b.ID))
+	})
+	return tables
+}
+
+// tableOrder sorts the main table before all others.
+func tableOrder(id int) int {
+	if id == MainTable {
+		return -1
+	}
+	return id
+}
+
+// TableName returns the name of a routing table, or its number if it has none.
+func TableName(table int) string {
+	loadTableNames()
+	tablesMu.RLock()
+	defer tablesMu.RUnlock()
+	if name, ok := tableNames[table]; ok {
+		return name
+	}
+	return strconv.Itoa(table)
+}
+
+// ParseTable resolves a table name, VRF name or number to a table ID.
+// An empty string is the main table, which saved routes store as 0.
+func ParseTable(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+		if id == MainTable {
+			return 0, nil
+		}
+		return int(id), nil
+	}
+
+	loadTableNames()
+	tablesMu.RLock()
+	defer tablesMu.RUnlock()
+	for id, name := range tableNames {
+		if name == s {
+			if id == MainTable {
+				return 0, nil
+			}
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown routing table %q", s)
+}
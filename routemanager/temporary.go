@@ -0,0 +1,311 @@
+package routemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// The schedule of temporary routes is saved next to the routes, so routes
+// still expire when the app was closed in the meantime.
+const scheduleFile = "temporary_routes.json"
+
+// scheduleCheckInterval caps how long the watcher sleeps. Timers stop while the
+// machine is suspended and ignore changes of the wall clock, so it looks again
+// regularly rather than trusting one long timer.
+const scheduleCheckInterval = time.Minute
+
+// TemporaryRoute is a route that is removed again at ExpiresAt.
+type TemporaryRoute struct {
+	Route     StaticRoute `json:"route"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// scheduleChanged wakes WatchSchedule when a route was scheduled.
+var scheduleChanged = make(chan struct{}, 1)
+
+// AddTemporary applies a route like Add and removes it again after lifetime.
+// Adding a route that is already temporary starts its lifetime over. IPv6 routes
+// also get the kernel's own expiry, so they go away even if the app never runs
+// again; the schedule still covers multipath routes and kernels that ignore it.
+func AddTemporary(route StaticRoute, lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return errors.New("a temporary route needs a lifetime")
+	}
+	var err error
+	if ip, _, parseErr := net.ParseCIDR(route.Destination); parseErr == nil && ip.To4() == nil && !route.IsMultipath() {
+		err = addExpiring(route, lifetime)
+	} else {
+		err = Add(route)
+	}
+	if err != nil {
+		return err
+	}
+	// Stored the way live routes are listed, so Matches finds it again.
+	if err := normalizeRoute(&route); err != nil {
+		return err
+	}
+
+	entry := TemporaryRoute{Route: route, ExpiresAt: time.Now().Add(lifetime)}
+	err = modifySchedule(func(schedule []TemporaryRoute) ([]TemporaryRoute, error) {
+		if i := indexOfTemporary(schedule, route); i >= 0 {
+			schedule[i] = entry
+			return schedule, nil
+		}
+		return append(schedule, entry), nil
+	})
+	if err != nil {
+		return fmt.Errorf("route was added, but its expiry could not be recorded: %w", err)
+	}
+
+	select {
+	case scheduleChanged <- struct{}{}:
+	default: // A wake-up is already on its way
+	}
+	return nil
+}
+
+// addExpiring is Add for a single-path IPv6 route that the kernel removes by itself
+// after lifetime. netlink has no field for RTA_EXPIRES, so the request is put
+// together here the way netlink builds it for the fields our routes use.
+func addExpiring(route StaticRoute, lifetime time.Duration) error {
+	h, err := handleFor(route.Namespace)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	routeObj, err := buildAddedRoute(h, route)
+	if err != nil {
+		return err
+	}
+
+	ns := netns.None()
+	if route.Namespace != "" {
+		if ns, err = openNamespace(route.Namespace); err != nil {
+			return err
+		}
+		defer ns.Close()
+	}
+	sock, err := nl.GetNetlinkSocketAt(ns, netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("could not open netlink socket: %w", err)
+	}
+	defer sock.Close()
+
+	req := nl.NewNetlinkRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	req.Sockets = map[int]*nl.SocketHandle{unix.NETLINK_ROUTE: {Socket: sock}}
+	msg := nl.NewRtMsg()
+	msg.Family = unix.AF_INET6
+	msg.Scope = uint8(routeObj.Scope)
+	msg.Flags = uint32(routeObj.Flags)
+	if routeObj.Type > 0 {
+		msg.Type = uint8(routeObj.Type)
+	}
+	ones, _ := routeObj.Dst.Mask.Size()
+	msg.Dst_len = uint8(ones)
+
+	attrs := []*nl.RtAttr{nl.NewRtAttr(unix.RTA_DST, routeObj.Dst.IP.To16())}
+	if routeObj.Table >= 256 {
+		msg.Table = unix.RT_TABLE_UNSPEC
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_TABLE, nl.Uint32Attr(uint32(routeObj.Table))))
+	} else if routeObj.Table > 0 {
+		msg.Table = uint8(routeObj.Table)
+	}
+	if routeObj.Gw != nil {
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_GATEWAY, routeObj.Gw.To16()))
+	}
+	if routeObj.Src != nil {
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_PREFSRC, routeObj.Src.To16()))
+	}
+	if routeObj.LinkIndex > 0 {
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_OIF, nl.Uint32Attr(uint32(routeObj.LinkIndex))))
+	}
+	if routeObj.Priority > 0 {
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_PRIORITY, nl.Uint32Attr(uint32(routeObj.Priority))))
+	}
+	var metrics []*nl.RtAttr
+	for _, metric := range []struct {
+		attr  int
+		value int
+	}{
+		{unix.RTAX_MTU, routeObj.MTU},
+		{unix.RTAX_ADVMSS, routeObj.AdvMSS},
+		{unix.RTAX_INITCWND, routeObj.InitCwnd},
+		{unix.RTAX_INITRWND, routeObj.InitRwnd},
+	} {
+		if metric.value > 0 {
+			metrics = append(metrics, nl.NewRtAttr(metric.attr, nl.Uint32Attr(uint32(metric.value))))
+		}
+	}
+	if routeObj.Congctl != "" {
+		metrics = append(metrics, nl.NewRtAttr(unix.RTAX_CC_ALGO, nl.ZeroTerminated(routeObj.Congctl)))
+	}
+	if metrics != nil {
+		attr := nl.NewRtAttr(unix.RTA_METRICS, nil)
+		for _, metric := range metrics {
+			attr.AddChild(metric)
+		}
+		attrs = append(attrs, attr)
+	}
+	// In seconds, rounded up so a lifetime never ends early.
+	seconds := uint32((lifetime + time.Second - 1) / time.Second)
+	attrs = append(attrs, nl.NewRtAttr(unix.RTA_EXPIRES, nl.Uint32Attr(seconds)))
+
+	req.AddData(msg)
+	for _, attr := range attrs {
+		req.AddData(attr)
+	}
+	_, err = req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+// ExpiryFor returns when a live route expires, if it is temporary.
+func ExpiryFor(schedule []TemporaryRoute, route SystemRoute) (time.Time, bool) {
+	for _, t := range schedule {
+		if t.Route.Matches(route) {
+			return t.ExpiresAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ExpireRoutes removes the temporary routes whose time is up. A route that is
+// already gone, or whose interface is, is dropped from the schedule; any other
+// failure keeps it there to be tried again. It reports how many routes were removed.
+func ExpireRoutes() (int, error) {
+	schedule, err := LoadSchedule()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	removed := 0
+	var errs []error
+	var done []TemporaryRoute
+	for _, t := range schedule {
+		if now.Before(t.ExpiresAt) {
+			continue
+		}
+		err := Delete(t.Route)
+		switch {
+		case err == nil:
+			log.Printf("Removed temporary route %s", t.Route)
+			removed++
+		case errors.Is(err, unix.ESRCH) || errors.Is(err, ErrInterfaceNotFound):
+			// Deleted by hand, or it went away with its interface.
+		default:
+			errs = append(errs, fmt.Errorf("%s: %w", t.Route, err))
+			continue
+		}
+		done = append(done, t)
+	}
+
+	// Routes added again while they were being removed have a new expiry and stay.
+	if len(done) > 0 {
+		err := modifySchedule(func(schedule []TemporaryRoute) ([]TemporaryRoute, error) {
+			return slices.DeleteFunc(schedule, func(t TemporaryRoute) bool {
+				i := indexOfTemporary(done, t.Route)
+				return i >= 0 && done[i].ExpiresAt.Equal(t.ExpiresAt)
+			}), nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// WatchSchedule removes temporary routes as they expire, until done is closed.
+// Routes that expired while the app wasn't running are removed right away.
+// onChange is called after routes were removed.
+func WatchSchedule(done <-chan struct{}, onChange func()) {
+	go func() {
+		for {
+			removed, err := ExpireRoutes()
+			if err != nil {
+				log.Printf("ERROR: Could not remove expired routes: %v", err)
+			}
+			if removed > 0 && onChange != nil {
+				onChange()
+			}
+
+			timer := time.NewTimer(nextScheduleCheck())
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-scheduleChanged:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// nextScheduleCheck is how long to sleep until the next route expires.
+func nextScheduleCheck() time.Duration {
+	schedule, err := LoadSchedule()
+	if err != nil || len(schedule) == 0 {
+		return scheduleCheckInterval
+	}
+	next := slices.MinFunc(schedule, func(a, b TemporaryRoute) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	return min(max(time.Until(next.ExpiresAt), 0), scheduleCheckInterval)
+}
+
+// indexOfTemporary finds the entry of a route the kernel would see as the same one.
+func indexOfTemporary(schedule []TemporaryRoute, route StaticRoute) int {
+	return slices.IndexFunc(schedule, func(t TemporaryRoute) bool {
+		return sameKernelRoute(t.Route, route) && t.Route.Namespace == route.Namespace
+	})
+}
+
+// modifySchedule does a read-modify-write of the schedule while holding the store's lock.
+func modifySchedule(modify func(schedule []TemporaryRoute) ([]TemporaryRoute, error)) error {
+	dir := StoreDir()
+	return withStoreLock(dir, func() error {
+		schedule, err := LoadSchedule()
+		if err != nil {
+			return err
+		}
+		if schedule, err = modify(schedule); err != nil {
+			return err
+		}
+		return saveSchedule(schedule)
+	})
+}
+
+// saveSchedule overwrites temporary_routes.json with the given schedule.
+// The caller holds the store's lock.
+func saveSchedule(schedule []TemporaryRoute) error {
+	data, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFile(StoreDir(), scheduleFile, data)
+}
+
+// LoadSchedule reads the temporary routes. A missing file means there are none.
+func LoadSchedule() ([]TemporaryRoute, error) {
+	data, err := readStoreFile(StoreDir(), scheduleFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TemporaryRoute{}, nil
+		}
+		return nil, err
+	}
+
+	var schedule []TemporaryRoute
+	if err = json.Unmarshal(data, &schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
@@ -0,0 +1,129 @@
+package routemanager
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scheduleOf loads the schedule of the test's store.
+func scheduleOf(t *testing.T) []TemporaryRoute {
+	t.Helper()
+	schedule, err := LoadSchedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schedule
+}
+
+func TestScheduleRoundTrip(t *testing.T) {
+	inTestStore(t)
+	if got := scheduleOf(t); len(got) != 0 {
+		t.Fatalf("a new store has schedule %+v", got)
+	}
+
+	expires := time.Now().Add(time.Hour).Round(0)
+	want := []TemporaryRoute{
+		{Route: StaticRoute{Destination: "10.0.0.0/24", Interface: "eth0", Gateway: "192.168.1.1"}, ExpiresAt: expires},
+		{Route: StaticRoute{Destination: "2001:db8::/64", Interface: "eth0", Table: 100}, ExpiresAt: expires.Add(time.Minute)},
+	}
+	err := modifySchedule(func(schedule []TemporaryRoute) ([]TemporaryRoute, error) {
+		return append(schedule, want...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := scheduleOf(t)
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Route.String() != want[i].Route.String() || !got[i].ExpiresAt.Equal(want[i].ExpiresAt) {
+			t.Errorf("loaded %s until %s, want %s until %s", got[i].Route, got[i].ExpiresAt, want[i].Route, want[i].ExpiresAt)
+		}
+	}
+}
+
+func TestExpireRoutesDropsExpiredEntries(t *testing.T) {
+	inTestStore(t)
+	now := time.Now()
+	// The interface is gone, so deleting the route finds nothing to do.
+	expired := StaticRoute{Destination: "10.0.0.0/24", Interface: "nosuchif0"}
+	waiting := StaticRoute{Destination: "10.1.0.0/24", Interface: "nosuchif0"}
+	err := modifySchedule(func([]TemporaryRoute) ([]TemporaryRoute, error) {
+		return []TemporaryRoute{
+			{Route: expired, ExpiresAt: now.Add(-time.Minute)},
+			{Route: waiting, ExpiresAt: now.Add(time.Hour)},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := ExpireRoutes()
+	if err != nil || removed != 0 {
+		t.Errorf("ExpireRoutes = %d, %v, want 0, nil", removed, err)
+	}
+	got := scheduleOf(t)
+	if len(got) != 1 || got[0].Route.Destination != waiting.Destination {
+		t.Errorf("left %+v, want only the route that hasn't expired", got)
+	}
+}
+
+func TestAddTemporary(t *testing.T) {
+	inTestNamespace(t)
+	inTestStore(t)
+	addTestInterface(t, "tmptest0", "192.0.2.10/24")
+	addTestInterface(t, "tmptest1", "2001:db8::10/64")
+
+	// Adding a route again starts its lifetime over.
+	route := StaticRoute{Destination: "198.51.100.0/24", Interface: "tmptest0", Gateway: "192.0.2.1"}
+	if err := AddTemporary(route, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	first := scheduleOf(t)
+	if err := AddTemporary(route, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	again := scheduleOf(t)
+	if len(first) != 1 || len(again) != 1 {
+		t.Fatalf("scheduled %+v, then %+v, want the route once", first, again)
+	}
+	if !again[0].ExpiresAt.After(first[0].ExpiresAt.Add(30 * time.Minute)) {
+		t.Errorf("expires at %s after adding it again, was %s", again[0].ExpiresAt, first[0].ExpiresAt)
+	}
+
+	// An IPv6 route also carries the kernel's expiry, and is on the schedule too.
+	route6 := StaticRoute{Destination: "2001:db8:1::/64", Interface: "tmptest1", Metric: 100}
+	if err := AddTemporary(route6, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduleOf(t)) != 2 {
+		t.Errorf("scheduled %+v, want both routes", scheduleOf(t))
+	}
+	if out, err := exec.Command("ip", "-6", "route", "show", route6.Destination).Output(); err != nil {
+		t.Logf("could not check the kernel's expiry with ip: %v", err)
+	} else if !strings.Contains(string(out), "dev tmptest1") || !strings.Contains(string(out), "expires") {
+		t.Errorf("ip -6 route show %s = %q, want a route that expires", route6.Destination, out)
+	}
+
+	// Once expired, ExpireRoutes removes both from the kernel and the schedule.
+	err := modifySchedule(func(schedule []TemporaryRoute) ([]TemporaryRoute, error) {
+		for i := range schedule {
+			schedule[i].ExpiresAt = time.Now().Add(-time.Second)
+		}
+		return schedule, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := ExpireRoutes()
+	if err != nil || removed != 2 {
+		t.Errorf("ExpireRoutes = %d, %v, want 2, nil", removed, err)
+	}
+	if got := scheduleOf(t); len(got) != 0 {
+		t.Errorf("left %+v on the schedule", got)
+	}
+}
@@ -0,0 +1,134 @@
+package routemanager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// tunnelKinds are the link kinds, as netlink reports them, that VPNs use:
+// tun/tap for OpenVPN, wireguard, and the kernel's IP tunnels for IPsec and GRE.
+var tunnelKinds = []string{
+	"tuntap", "wireguard", "ipip", "ip6tnl", "sit", "vti", "vti6",
+	"gre", "ip6gre", "gretap", "ip6gretap", "xfrm",
+}
+
+// A VPN client removes the routes on its tunnel when it disconnects and doesn't put
+// them back on reconnect. Saved routes with ReapplyOn set are applied again whenever
+// that tunnel comes up or gets an address. Bypass routes, which reach the VPN server
+// via the physical gateway, go through the same tunnel while being on another interface.
+
+// IsTunnel reports whether a link is a VPN or IP tunnel.
+func IsTunnel(link netlink.Link) bool {
+	return slices.Contains(tunnelKinds, link.Type())
+}
+
+// TunnelInterfaces lists the tunnels of the current namespace, including those that are down.
+func TunnelInterfaces() []string {
+	var names []string
+	for _, link := range listLinks(CurrentNamespace()) {
+		if IsTunnel(link) {
+			names = append(names, link.Attrs().Name)
+		}
+	}
+	return names
+}
+
+// ReapplyTunnelRoutes applies the enabled saved routes that follow the tunnel.
+// A route whose interface isn't there yet is skipped: it is applied on a later event.
+func ReapplyTunnelRoutes(tunnel string) (int, error) {
+	routes, err := LoadRoutes()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	var errs []error
+	for _, route := range routes {
+		if route.ReapplyOn != tunnel || !route.Enabled() || route.Namespace != "" {
+			continue
+		}
+		if err := Add(route); err != nil {
+			if !errors.Is(err, ErrInterfaceNotFound) {
+				errs = append(errs, fmt.Errorf("%s: %w", route, err))
+			}
+			continue
+		}
+		if err := MarkApplied(route); err != nil {
+			log.Printf("WARN: Could not record when the route was applied: %v", err)
+		}
+		applied++
+	}
+	return applied, errors.Join(errs...)
+}
+
+// WatchTunnels re-applies the routes of a tunnel whenever it comes up or gets an
+// address, until done is closed. It follows the host's namespace; onChange is
+// called after routes were re-applied.
+func WatchTunnels(done <-chan struct{}, onChange func()) error {
+	links := make(chan netlink.LinkUpdate)
+	if err := netlink.LinkSubscribe(links, done); err != nil {
+		return fmt.Errorf("could not watch tunnels: %w", err)
+	}
+	addrs := make(chan netlink.AddrUpdate)
+	if err := netlink.AddrSubscribe(addrs, done); err != nil {
+		return fmt.Errorf("could not watch tunnel addresses: %w", err)
+	}
+
+	go func() {
+		up := map[int]bool{}      // Tunnels that are up, by interface index
+		names := map[int]string{} // Tunnel names, for the address events which only carry the index
+		reapply := func(name string) {
+			applied, err := ReapplyTunnelRoutes(name)
+			if err != nil {
+				log.Printf("ERROR: Could not re-apply the routes of %s: %v", name, err)
+			}
+			if applied > 0 {
+				log.Printf("Re-applied %d route(s) after %s came up", applied, name)
+				if onChange != nil {
+					onChange()
+				}
+			}
+		}
+
+		for links != nil || addrs != nil {
+			select {
+			case update, ok := <-links:
+				if !ok {
+					links = nil
+					continue
+				}
+				if !IsTunnel(update.Link) {
+					continue
+				}
+				attrs := update.Link.Attrs()
+				isUp := attrs.Flags&net.FlagUp != 0 && update.Header.Type != unix.RTM_DELLINK
+				wasUp := up[attrs.Index]
+				if isUp {
+					up[attrs.Index], names[attrs.Index] = true, attrs.Name
+				} else {
+					delete(up, attrs.Index)
+					delete(names, attrs.Index)
+				}
+				if isUp && !wasUp {
+					reapply(attrs.Name)
+				}
+			case update, ok := <-addrs:
+				if !ok {
+					addrs = nil
+					continue
+				}
+				// Routes via a gateway inside the tunnel need its address first.
+				if name, ok := names[update.LinkIndex]; ok && update.NewAddr {
+					reapply(name)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -1,6 +1,9 @@
 package validators
 
-import "net"
+import (
+	"net"
+	"strconv"
+)
 
 // ValidateCIDR checks if a string is a valid CIDR notation (e.g., "192.168.1.0/24").
 // It is exported because it starts with a capital 'V'.
@@ -14,3 +17,18 @@ func ValidateCIDR(s string) bool {
 func ValidateIP(s string) bool {
 	return net.ParseIP(s) != nil
 }
+
+// ValidateOptionalIP accepts an empty string or a valid IP address.
+func ValidateOptionalIP(s string) bool {
+	return s == "" || ValidateIP(s)
+}
+
+// ValidateOptionalUint accepts an empty string or a non-negative whole number,
+// as used for metrics and table IDs.
+func ValidateOptionalUint(s string) bool {
+	if s == "" {
+		return true
+	}
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}